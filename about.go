@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	docker "docker.io/go-docker"
+	"docker.io/go-docker/api/types"
+)
+
+// daemonVersion is what the daemon reported when the shell connected to it
+var daemonVersion = struct {
+	sync.Mutex
+	version types.Version
+	err     error
+}{}
+
+// pinnedAPIVersion is the API version DOCKER_API_VERSION pins clients to, like the docker CLI
+func pinnedAPIVersion() string {
+	return os.Getenv("DOCKER_API_VERSION")
+}
+
+// negotiateAPIVersion lowers the API version of the client to the one of an older daemon, unless DOCKER_API_VERSION
+// pins it, and hides the commands and flags the daemon doesn't support from completion. Only NewEnvClient marks
+// the pin as a manual override, the clients of the other contexts would be negotiated down.
+func negotiateAPIVersion(ctx context.Context, client *docker.Client, ping types.Ping) types.Version {
+	if pinnedAPIVersion() == "" {
+		client.NegotiateAPIVersionPing(ping)
+	}
+	shellCommands.SetAPIVersion(client.ClientVersion())
+
+	version, err := client.ServerVersion(ctx)
+	daemonVersion.Lock()
+	daemonVersion.version, daemonVersion.err = version, err
+	daemonVersion.Unlock()
+
+	return version
+}
+
+// warnUnsupported tells before running a command that the daemon is too old for it, the CLI has the last word
+func warnUnsupported(args []string) {
+	name, required, ok := shellCommands.Unsupported(args)
+	switch {
+	case !ok:
+	case required == "":
+		fmt.Fprintf(os.Stderr, "warning: %s doesn't implement %s\n", activeEngine(), name)
+	default:
+		fmt.Fprintf(os.Stderr, "warning: %s requires API %s, the daemon speaks %s\n", name, required, shellCommands.APIVersion())
+	}
+}
+
+func aboutBuiltin(args []string) {
+	current := currentConnection()
+	host := ""
+	if dockerCtx, err := findDockerContext(current.context); err == nil {
+		host = " (" + dockerCtx.Host + ")"
+	}
+	connection := "connected"
+	if !health.Connected() {
+		connection = "disconnected"
+	}
+	negotiation := "negotiated"
+	if pinnedAPIVersion() != "" {
+		negotiation = "pinned by DOCKER_API_VERSION"
+	}
+
+	lines := []string{
+		fmt.Sprintf("Context:     %s%s", current.context, host),
+		fmt.Sprintf("Connection:  %s", connection),
+		fmt.Sprintf("Engine:      %s", current.engine),
+		fmt.Sprintf("Client API:  %s (%s)", current.client.ClientVersion(), negotiation),
+	}
+
+	daemonVersion.Lock()
+	version, err := daemonVersion.version, daemonVersion.err
+	daemonVersion.Unlock()
+	switch {
+	case err != nil:
+		lines = append(lines, fmt.Sprintf("Daemon:      unknown (%v)", err))
+	case version.Version == "":
+		lines = append(lines, "Daemon:      unknown, it didn't answer yet")
+	default:
+		daemon := fmt.Sprintf("Daemon:      %s, API %s", version.Version, version.APIVersion)
+		if version.MinAPIVersion != "" {
+			daemon += fmt.Sprintf(" (minimum %s)", version.MinAPIVersion)
+		}
+		lines = append(lines, daemon, fmt.Sprintf("Platform:    %s/%s, kernel %s", version.Os, version.Arch, version.KernelVersion))
+		if version.Experimental {
+			lines = append(lines, "Experimental: enabled")
+		}
+	}
+
+	if apiVersion := shellCommands.APIVersion(); apiVersion != "" {
+		lines = append(lines, fmt.Sprintf("Completion:  commands and flags of API %s", apiVersion))
+	}
+
+	fmt.Println(strings.Join(lines, "\n"))
+}
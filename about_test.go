@@ -0,0 +1,78 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// captureStdout returns what run prints
+func captureStdout(t *testing.T, run func()) string {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := os.Stdout
+	os.Stdout = writer
+	run()
+	os.Stdout = previous
+	writer.Close()
+
+	output, _ := ioutil.ReadAll(reader)
+	return string(output)
+}
+
+// DOCKER_API_VERSION pins the clients of every context, not only the one NewEnvClient creates
+func TestDockerAPIVersionPinsTheClient(t *testing.T) {
+	defer useFakeDaemon(t, fakeDaemonSize{})()
+	daemon := newFakeDaemon(fakeDaemonSize{})
+	daemon.apiVersion = "1.30"
+	server := httptest.NewServer(daemon)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "docker-shell-contexts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeDockerContext(t, dir, "remote", "tcp://"+server.Listener.Addr().String())
+	os.Setenv("DOCKER_CONFIG", dir)
+	previous, set := os.LookupEnv("DOCKER_API_VERSION")
+	defer func() {
+		if set {
+			os.Setenv("DOCKER_API_VERSION", previous)
+		} else {
+			os.Unsetenv("DOCKER_API_VERSION")
+		}
+	}()
+
+	for _, test := range []struct {
+		pinned string
+		want   string
+		about  string
+	}{
+		{"", "1.30", "Client API:  1.30 (negotiated)"},
+		{"1.35", "1.35", "Client API:  1.35 (pinned by DOCKER_API_VERSION)"},
+	} {
+		os.Setenv("DOCKER_API_VERSION", test.pinned)
+		if err := connectContext("remote"); err != nil {
+			t.Fatal(err)
+		}
+		current := currentConnection()
+
+		if version := current.client.ClientVersion(); version != test.want {
+			t.Errorf("DOCKER_API_VERSION=%q: the client speaks %s, want %s", test.pinned, version, test.want)
+		}
+		if version := shellCommands.APIVersion(); version != test.want {
+			t.Errorf("DOCKER_API_VERSION=%q: completion follows API %s, want %s", test.pinned, version, test.want)
+		}
+		if output := captureStdout(t, func() { aboutBuiltin(nil) }); !strings.Contains(output, test.about) {
+			t.Errorf("DOCKER_API_VERSION=%q: about shows\n%s", test.pinned, output)
+		}
+
+		current.stop()
+		current.client.Close()
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/c-bata/go-prompt"
+)
+
+// builtins are the commands handled by the shell itself instead of being passed to the docker CLI
+var builtins = map[string]func(args []string){
+	"help":           helpBuiltin,
+	"cache":          cacheBuiltin,
+	"inspect-remote": inspectRemoteBuiltin,
+	"pin":            pinBuiltin,
+	"outdated":       outdatedBuiltin,
+	"hub-status":     hubStatusBuiltin,
+	"context use":    contextUseBuiltin,
+	"about":          aboutBuiltin,
+}
+
+func runBuiltin(args []string) bool {
+	name, ok := builtinName(args)
+	if !ok {
+		return false
+	}
+
+	builtins[name](args[len(strings.Fields(name)):])
+	return true
+}
+
+// builtinName returns the builtin a command line runs. Subcommands like `context use` are handled by the shell
+// while the rest of the command goes to the CLI.
+func builtinName(args []string) (string, bool) {
+	if len(args) > 1 {
+		if _, ok := builtins[args[0]+" "+args[1]]; ok {
+			return args[0] + " " + args[1], true
+		}
+	}
+	if len(args) > 0 {
+		if _, ok := builtins[args[0]]; ok {
+			return args[0], true
+		}
+	}
+
+	return "", false
+}
+
+func helpBuiltin(args []string) {
+	text, ok := shellCommands.Help(strings.Join(args, " "))
+	if !ok {
+		fmt.Fprintf(os.Stderr, "help: unknown command %q\n", strings.Join(args, " "))
+		return
+	}
+
+	fmt.Print(text)
+}
+
+func cacheBuiltin(args []string) {
+	action := ""
+	if len(args) > 0 {
+		action = args[0]
+	}
+
+	switch action {
+	case "clear":
+		removed, err := completionCache.Clear()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "cache:", err)
+			return
+		}
+		fmt.Printf("Removed %d cached entries\n", removed)
+	case "stats", "":
+		fmt.Println(completionCache.Stats())
+	default:
+		fmt.Fprintf(os.Stderr, "cache: unknown action %q, expected clear or stats\n", action)
+	}
+}
+
+func inspectRemoteBuiltin(args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage:", shellCommands.Usage("inspect-remote"))
+		return
+	}
+
+	if err := inspectRemote(args[0]); err != nil {
+		fmt.Fprintln(os.Stderr, "inspect-remote:", err)
+	}
+}
+
+func pinBuiltin(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage:", shellCommands.Usage("pin"))
+		return
+	}
+
+	for _, reference := range args {
+		pinned, source, err := pinnedReference(reference)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "pin:", err)
+			continue
+		}
+		fmt.Printf("%s\t(%s)\n", pinned, source)
+	}
+}
+
+// helpKeyBind shows the help of the command under the cursor without leaving the prompt
+func helpKeyBind(b *prompt.Buffer) {
+	command, _ := shellCommands.FindCommand(b.Document().TextBeforeCursor())
+	text, ok := shellCommands.Help(command)
+	if !ok {
+		return
+	}
+
+	// the terminal is in raw mode while the prompt is active
+	fmt.Print("\r\n" + strings.Replace(text, "\n", "\r\n", -1))
+}
+
+// helpQuestionMarkBind shows help when `?` is typed at the start of a word and inserts it otherwise
+func helpQuestionMarkBind(b *prompt.Buffer) {
+	if b.Document().GetWordBeforeCursor() == "" {
+		helpKeyBind(b)
+		return
+	}
+
+	b.InsertText("?", false, true)
+}
+
+func helpCompleter(d prompt.Document) []prompt.Suggest {
+	word := d.GetWordBeforeCursor()
+	fields := strings.Fields(strings.TrimSuffix(d.TextBeforeCursor(), word))
+	if len(fields) <= 1 {
+		return prompt.FilterHasPrefix(shellCommands.GetDockerSuggestions(), word, true)
+	}
+
+	command, ok := shellCommands.FindCommand(strings.Join(fields[1:], " "))
+	if !ok {
+		return []prompt.Suggest{}
+	}
+
+	val, _ := shellCommands.IsDockerSubCommand(command)
+	subcommands := []prompt.Suggest{}
+	for _, s := range val {
+		if !strings.HasPrefix(s.Text, "-") {
+			subcommands = append(subcommands, s)
+		}
+	}
+
+	return prompt.FilterHasPrefix(subcommands, word, true)
+}
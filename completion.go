@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	docker "docker.io/go-docker"
+	"github.com/c-bata/go-prompt"
+)
+
+const (
+	// sourceDebounce is how long typing has to pause before a data source is reloaded
+	sourceDebounce = 150 * time.Millisecond
+	// sourceDeadline bounds a daemon call made for completion
+	sourceDeadline = 2 * time.Second
+	// completerDeadline bounds a completer, which should only read data loaded in the background
+	completerDeadline = 500 * time.Millisecond
+	// completionDeadline bounds the whole completion, it outlasts completerDeadline so the guards of the
+	// completers it runs report which source didn't answer
+	completionDeadline = 2 * completerDeadline
+)
+
+// refreshSequence is the escape sequence go-prompt reads as the Ignore key. It is injected to make the prompt call
+// the completer again and redraw the dropdown once a data source has loaded.
+var refreshSequence = []byte{0x1b, 0x5b, 0x45}
+
+// dataSource is daemon data completers read without waiting: the last loaded value is returned immediately,
+// reloading happens in the background once typing pauses
+type dataSource struct {
+	ttl      time.Duration
+	deadline time.Duration
+	load     func(ctx context.Context, client *docker.Client) (interface{}, error)
+	// parent and client belong to the connection the source was created for
+	parent context.Context
+	client *docker.Client
+
+	lock      sync.Mutex
+	value     interface{}
+	err       error
+	loaded    time.Time
+	loading   bool
+	requested time.Time
+}
+
+// dataSources are the sources of the current connection, their loads are cancelled when it is replaced
+var dataSources = struct {
+	sync.Mutex
+	sources map[string]*dataSource
+	ctx     context.Context
+	cancel  context.CancelFunc
+	client  *docker.Client
+}{sources: map[string]*dataSource{}, ctx: context.Background(), cancel: func() {}}
+
+// fetchAsync decodes the last value of the source key into target and schedules a reload when it is older than ttl.
+// It returns false while nothing has been loaded yet. A load which runs into its deadline may return partial data
+// with its error, the partial data is shown and loaded again on the next call. load is given the client of the
+// connection the source belongs to.
+func fetchAsync(key string, ttl time.Duration, deadline time.Duration, target interface{}, load func(ctx context.Context, client *docker.Client) (interface{}, error)) bool {
+	dataSources.Lock()
+	source, ok := dataSources.sources[key]
+	if !ok {
+		source = &dataSource{ttl: ttl, deadline: deadline, load: load, parent: dataSources.ctx, client: dataSources.client}
+		dataSources.sources[key] = source
+	}
+	dataSources.Unlock()
+
+	source.lock.Lock()
+	defer source.lock.Unlock()
+
+	if time.Since(source.loaded) >= source.ttl {
+		source.requested = time.Now()
+		if !source.loading {
+			source.loading = true
+			go source.reload()
+		}
+	}
+	if source.value == nil {
+		return false
+	}
+
+	reflect.ValueOf(target).Elem().Set(reflect.ValueOf(source.value))
+	return true
+}
+
+func (s *dataSource) reload() {
+	for {
+		s.lock.Lock()
+		wait := sourceDebounce - time.Since(s.requested)
+		s.lock.Unlock()
+		if wait <= 0 {
+			break
+		}
+		time.Sleep(wait)
+	}
+
+	ctx, cancel := context.WithTimeout(s.parent, s.deadline)
+	defer cancel()
+	value, err := s.guardedLoad(ctx)
+	if s.parent.Err() != nil {
+		// the connection was replaced, nobody reads this source anymore
+		return
+	}
+
+	stored := value != nil && (err == nil || hasData(value))
+	s.lock.Lock()
+	s.loading = false
+	s.err = err
+	if stored {
+		s.value = value
+	}
+	if err == nil {
+		s.loaded = time.Now()
+	}
+	s.lock.Unlock()
+
+	if stored || err != nil {
+		completionEngine.refresh()
+	}
+}
+
+// guardedLoad turns a panic of the load function into an error
+func (s *dataSource) guardedLoad(ctx context.Context) (value interface{}, err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			value, err = nil, fmt.Errorf("panic: %v", recovered)
+		}
+	}()
+
+	return s.load(ctx, s.client)
+}
+
+// sourceError returns the error of the last load of a data source which has nothing to show
+func sourceError(key string) error {
+	dataSources.Lock()
+	source, ok := dataSources.sources[key]
+	dataSources.Unlock()
+	if !ok {
+		return nil
+	}
+
+	source.lock.Lock()
+	defer source.lock.Unlock()
+	if source.value != nil && hasData(source.value) {
+		return nil
+	}
+
+	return source.err
+}
+
+// guardSource runs a completer with a deadline and panic recovery. A failing completer doesn't take the shell
+// down, it is reported by a "<name> unavailable: <reason>" entry after whatever it could still suggest.
+func guardSource(name string, d prompt.Document, complete func() ([]prompt.Suggest, error)) []prompt.Suggest {
+	return guardSourceWithin(name, completerDeadline, d, complete)
+}
+
+// guardedCalls are the sources with a call running. A source which doesn't answer keeps its goroutine until it
+// returns, it isn't called again meanwhile so a hung source costs one goroutine rather than one per keystroke.
+var guardedCalls = struct {
+	sync.Mutex
+	running map[string]bool
+}{running: map[string]bool{}}
+
+// guardSourceWithin is guardSource with another deadline
+func guardSourceWithin(name string, deadline time.Duration, d prompt.Document, complete func() ([]prompt.Suggest, error)) []prompt.Suggest {
+	guardedCalls.Lock()
+	if guardedCalls.running[name] {
+		guardedCalls.Unlock()
+		return []prompt.Suggest{unavailableSuggestion(name, d, errors.New("still answering a previous completion"))}
+	}
+	guardedCalls.running[name] = true
+	guardedCalls.Unlock()
+
+	type result struct {
+		suggestions []prompt.Suggest
+		err         error
+	}
+	done := make(chan result, 1)
+	go func() {
+		defer func() {
+			guardedCalls.Lock()
+			delete(guardedCalls.running, name)
+			guardedCalls.Unlock()
+		}()
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				done <- result{err: fmt.Errorf("panic: %v", recovered)}
+			}
+		}()
+		suggestions, err := complete()
+		done <- result{suggestions, err}
+	}()
+
+	select {
+	case r := <-done:
+		if r.err != nil {
+			return append(r.suggestions, unavailableSuggestion(name, d, r.err))
+		}
+		return r.suggestions
+	case <-time.After(deadline):
+		return []prompt.Suggest{unavailableSuggestion(name, d, fmt.Errorf("no answer within %s", deadline))}
+	}
+}
+
+// unavailableSuggestion keeps the word being typed so selecting the entry changes nothing
+func unavailableSuggestion(name string, d prompt.Document, err error) prompt.Suggest {
+	return prompt.Suggest{Text: d.GetWordBeforeCursor(), Description: name + " unavailable: " + err.Error()}
+}
+
+// hasData tells whether a failed load still returned something worth showing
+func hasData(value interface{}) bool {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Ptr, reflect.Interface:
+		return !v.IsNil() && (v.Kind() != reflect.Slice || v.Len() > 0)
+	}
+
+	return !v.IsZero()
+}
+
+// invalidateSources marks every data source stale, after a command may have changed containers or images
+func invalidateSources() {
+	dataSources.Lock()
+	defer dataSources.Unlock()
+
+	for _, source := range dataSources.sources {
+		source.lock.Lock()
+		source.loaded = time.Time{}
+		source.lock.Unlock()
+	}
+}
+
+// resetSources forgets every data source and cancels their loads, after switching to the daemon of client
+func resetSources(client *docker.Client) {
+	dataSources.Lock()
+	defer dataSources.Unlock()
+
+	dataSources.cancel()
+	dataSources.ctx, dataSources.cancel = context.WithCancel(context.Background())
+	dataSources.sources = map[string]*dataSource{}
+	dataSources.client = client
+}
+
+// completionRefresher redraws the dropdown when background data arrives. go-prompt accepts the selected suggestion
+// on any key which isn't a navigation key, so the dropdown is only refreshed while nothing is selected: after the text
+// or the cursor changed, not after Tab or the arrow keys moved the selection.
+type completionRefresher struct {
+	sync.Mutex
+	active     bool
+	unselected bool
+	injected   bool
+	lastInput  string
+	lastCursor int
+
+	events chan []byte
+}
+
+var completionEngine = &completionRefresher{events: make(chan []byte, 1)}
+
+// observe is called by the completer on each call to follow whether a suggestion may be selected
+func (r *completionRefresher) observe(d prompt.Document) {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.injected {
+		r.injected = false
+	} else {
+		r.unselected = d.Text != r.lastInput || len(d.TextBeforeCursor()) != r.lastCursor
+	}
+	r.lastInput, r.lastCursor = d.Text, len(d.TextBeforeCursor())
+}
+
+func (r *completionRefresher) refresh() {
+	r.Lock()
+	defer r.Unlock()
+
+	if !r.active || !r.unselected || r.injected {
+		return
+	}
+	select {
+	case r.events <- refreshSequence:
+		r.injected = true
+	default:
+	}
+}
+
+// setActive tells whether a prompt is being shown, refreshes are dropped while a command runs
+func (r *completionRefresher) setActive(active bool) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.active, r.injected, r.unselected = active, false, false
+	r.lastInput, r.lastCursor = "", 0
+	select {
+	case <-r.events:
+	default:
+	}
+}
+
+// refreshingParser reads the keyboard and the refresh events of the completion engine
+type refreshingParser struct {
+	prompt.ConsoleParser
+	events chan []byte
+}
+
+func (r *completionRefresher) parser() prompt.ConsoleParser {
+	return &refreshingParser{ConsoleParser: prompt.NewStandardInputParser(), events: r.events}
+}
+
+func (p *refreshingParser) Read() ([]byte, error) {
+	select {
+	case event := <-p.events:
+		return event, nil
+	default:
+		return p.ConsoleParser.Read()
+	}
+}
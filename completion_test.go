@@ -0,0 +1,223 @@
+package main
+
+import (
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/c-bata/go-prompt"
+)
+
+// completerBudget is the time a completer call may take at the 95th percentile. go-prompt calls it on every key,
+// typing stops feeling instant somewhere around 50ms.
+const completerBudget = 50 * time.Millisecond
+
+// raceDetector is set when the tests run under the race detector, which makes timings meaningless
+var raceDetector bool
+
+// ciCompleterBudget is the budget checked by default. Shared CI runners and the race detector are several times
+// slower than a developer machine, it catches a completer which went back to calling the daemon.
+const ciCompleterBudget = 5 * completerBudget
+
+// completionInputs are representative lines, the cursor is at their end
+var completionInputs = []struct {
+	name string
+	text string
+}{
+	{"command", "ru"},
+	{"exec", "exec "},
+	{"start prefix", "start 0000"},
+	{"run image", "run ng"},
+	{"run ports", "run -p"},
+	{"pull hub", "pull nginx"},
+	{"network", "network inspect net"},
+	{"volume", "volume rm "},
+	{"compose", "compose logs "},
+}
+
+func unavailable(suggestions []prompt.Suggest) string {
+	for _, s := range suggestions {
+		if strings.Contains(s.Description, " unavailable: ") {
+			return s.Description
+		}
+	}
+
+	return ""
+}
+
+// completionLoading tells whether a data source or a cache entry is still being loaded in the background
+func completionLoading() bool {
+	dataSources.Lock()
+	defer dataSources.Unlock()
+	for _, source := range dataSources.sources {
+		source.lock.Lock()
+		loading := source.loading || source.loaded.IsZero()
+		source.lock.Unlock()
+		if loading {
+			return true
+		}
+	}
+
+	completionCache.lock.Lock()
+	defer completionCache.lock.Unlock()
+	return len(completionCache.refreshing) > 0
+}
+
+// warmCompletion completes every input until the background sources it reads have loaded. Sources are only
+// reloaded once typing pauses, so the completer isn't called again while they load.
+func warmCompletion(tb testing.TB) {
+	deadline := time.Now().Add(30 * time.Second)
+	for _, input := range completionInputs {
+		d := documentOf(input.text, len(input.text))
+		for completer(d); completionLoading(); completer(d) {
+			if time.Now().After(deadline) {
+				tb.Fatalf("%s: completion sources still loading after 30s", input.name)
+			}
+			time.Sleep(sourceDebounce + 50*time.Millisecond)
+		}
+	}
+}
+
+// TestCompleterLatency checks ciCompleterBudget, or completerBudget when DOCKER_SHELL_LATENCY_TEST is set.
+// Timings depend on the machine, the tight budget is meant for a quiet developer machine.
+func TestCompleterLatency(t *testing.T) {
+	budget := ciCompleterBudget
+	if os.Getenv("DOCKER_SHELL_LATENCY_TEST") != "" {
+		budget = completerBudget
+	}
+	if testing.Short() {
+		t.Skip("generates a large fake daemon")
+	}
+	if raceDetector {
+		t.Skip("the race detector slows completion down several times")
+	}
+	defer useFakeDaemon(t, largeHost)()
+	warmCompletion(t)
+
+	for _, input := range completionInputs {
+		d := documentOf(input.text, len(input.text))
+		durations := make([]time.Duration, 50)
+		for i := range durations {
+			start := time.Now()
+			suggestions := completer(d)
+			durations[i] = time.Since(start)
+
+			if reason := unavailable(suggestions); reason != "" {
+				t.Fatalf("%s: %s", input.name, reason)
+			}
+		}
+		sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+
+		if p95 := durations[len(durations)*95/100]; p95 > budget {
+			t.Errorf("%s: 95th percentile %s exceeds the %s budget", input.name, p95, budget)
+		}
+	}
+}
+
+func TestCompleterSuggestsFromFakeDaemon(t *testing.T) {
+	defer useFakeDaemon(t, fakeDaemonSize{Containers: 20, Images: 20, Networks: 3, Volumes: 3})()
+	warmCompletion(t)
+
+	for _, test := range []struct {
+		text string
+		want string
+	}{
+		{"exec ", fakeID('c', 0)},
+		{"run ng", "nginx:1.0"},
+		{"run -p", "-p 8000:8000/tcp"},
+		{"network inspect ", "network_0"},
+		{"volume rm vol", "volume_2"},
+	} {
+		found := false
+		for _, s := range completer(documentOf(test.text, len(test.text))) {
+			found = found || s.Text == test.want
+		}
+		if !found {
+			t.Errorf("%q: %q isn't suggested", test.text, test.want)
+		}
+	}
+}
+
+// a broken completer shows an unavailable entry instead of taking the shell down
+func TestGuardSourceRecoversPanics(t *testing.T) {
+	suggestions := guardSource("containers", documentOf("exec ", 5), func() ([]prompt.Suggest, error) {
+		var images []string
+		return []prompt.Suggest{{Text: images[0]}}, nil
+	})
+
+	if len(suggestions) != 1 || !strings.HasPrefix(suggestions[0].Description, "containers unavailable: panic") {
+		t.Errorf("unexpected suggestions %v", suggestions)
+	}
+}
+
+// a slow source is named by its own guard, the guard of the whole completion waits longer
+func TestGuardSourceNamesTheSlowSource(t *testing.T) {
+	d := documentOf("exec ", 5)
+	release := make(chan struct{})
+	defer waitGuardsIdle(t)
+	defer close(release)
+	suggestions := guardSourceWithin("completion", completionDeadline, d, func() ([]prompt.Suggest, error) {
+		return guardSource("containers", d, func() ([]prompt.Suggest, error) {
+			<-release
+			return nil, nil
+		}), nil
+	})
+
+	if len(suggestions) != 1 || !strings.HasPrefix(suggestions[0].Description, "containers unavailable: no answer") {
+		t.Errorf("unexpected suggestions %v", suggestions)
+	}
+}
+
+// waitGuardsIdle waits for the sources left running by a test to return
+func waitGuardsIdle(t *testing.T) {
+	waitFor(t, "the guarded sources to return", func() bool {
+		guardedCalls.Lock()
+		defer guardedCalls.Unlock()
+		return len(guardedCalls.running) == 0
+	})
+}
+
+// a hung source isn't called again on every keystroke, it is once it returned
+func TestGuardSourceCallsAHungSourceOnce(t *testing.T) {
+	d := documentOf("exec ", 5)
+	release := make(chan struct{})
+	calls := int32(0)
+	hung := func() ([]prompt.Suggest, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return []prompt.Suggest{{Text: "web"}}, nil
+	}
+
+	for i := 0; i < 3; i++ {
+		suggestions := guardSourceWithin("containers", 10*time.Millisecond, d, hung)
+		if len(suggestions) != 1 || !strings.HasPrefix(suggestions[0].Description, "containers unavailable: ") {
+			t.Errorf("call %d: unexpected suggestions %v", i, suggestions)
+		}
+	}
+	if calls := atomic.LoadInt32(&calls); calls != 1 {
+		t.Errorf("the hung source was called %d times", calls)
+	}
+
+	close(release)
+	waitGuardsIdle(t)
+	if suggestions := guardSource("containers", d, hung); len(suggestions) != 1 || suggestions[0].Text != "web" {
+		t.Errorf("the source isn't called again once it returned: %v", suggestions)
+	}
+}
+
+func BenchmarkCompleter(b *testing.B) {
+	defer useFakeDaemon(b, largeHost)()
+	warmCompletion(b)
+
+	for _, input := range completionInputs {
+		d := documentOf(input.text, len(input.text))
+		b.Run(input.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				completer(d)
+			}
+		})
+	}
+}
@@ -0,0 +1,409 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	docker "docker.io/go-docker"
+	"docker.io/go-docker/api/types"
+	"docker.io/go-docker/api/types/filters"
+
+	"github.com/c-bata/go-prompt"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	composeProjectLabel = "com.docker.compose.project"
+	composeServiceLabel = "com.docker.compose.service"
+)
+
+var composeDefaultFiles = []string{"compose.yaml", "compose.yml", "docker-compose.yml", "docker-compose.yaml"}
+var composeOverrideFiles = []string{"compose.override.yaml", "compose.override.yml", "docker-compose.override.yml", "docker-compose.override.yaml"}
+
+// composeValueFlags are the global compose flags which consume the next argument
+var composeValueFlags = map[string]bool{
+	"-f": true, "--file": true,
+	"-p": true, "--project-name": true,
+	"--profile": true, "--env-file": true, "--project-directory": true,
+	"--ansi": true, "--progress": true,
+}
+
+// composeSubCommandValueFlags are the flags of compose subcommands which consume the next argument
+var composeSubCommandValueFlags = map[string]map[string]bool{
+	"attach":  {"--detach-keys": true, "--index": true},
+	"build":   {"--build-arg": true, "--builder": true, "-m": true, "--memory": true, "--progress": true, "--ssh": true},
+	"create":  {"--pull": true, "--scale": true},
+	"exec":    {"-e": true, "--env": true, "--index": true, "-u": true, "--user": true, "-w": true, "--workdir": true},
+	"images":  {"--format": true},
+	"kill":    {"-s": true, "--signal": true},
+	"logs":    {"-n": true, "--tail": true, "--since": true, "--until": true, "--index": true},
+	"port":    {"--index": true, "--protocol": true},
+	"ps":      {"--filter": true, "--format": true, "--status": true},
+	"restart": {"-t": true, "--timeout": true},
+	"run": {
+		"--cap-add": true, "--cap-drop": true, "-e": true, "--env": true, "--entrypoint": true, "-l": true, "--label": true,
+		"--name": true, "-p": true, "--publish": true, "--pull": true, "-u": true, "--user": true, "-v": true,
+		"--volume": true, "-w": true, "--workdir": true,
+	},
+	"stop": {"-t": true, "--timeout": true},
+	"up": {
+		"--attach": true, "--exit-code-from": true, "--no-attach": true, "--pull": true, "--scale": true,
+		"-t": true, "--timeout": true, "--wait-timeout": true,
+	},
+}
+
+// composeServiceCommands are the compose subcommands which take service names as arguments.
+// The value tells whether only a single service is accepted.
+var composeServiceCommands = map[string]bool{
+	"attach": true, "build": false, "create": false, "events": false, "exec": true, "images": false,
+	"kill": false, "logs": false, "pause": false, "port": true, "ps": false, "pull": false, "push": false,
+	"restart": false, "rm": false, "run": true, "start": false, "stop": false, "top": false,
+	"unpause": false, "up": false,
+}
+
+var composeProjectNameExpression = regexp.MustCompile(`[^a-z0-9_-]`)
+
+type composeFile struct {
+	Name     string                        `yaml:"name"`
+	Services map[string]composeFileService `yaml:"services"`
+}
+
+type composeFileService struct {
+	Image    string   `yaml:"image"`
+	Profiles []string `yaml:"profiles"`
+}
+
+// composeArgs holds what has been typed after `compose` on the command line
+type composeArgs struct {
+	Files       []string
+	Project     string
+	ProjectDir  string
+	SubCommand  string
+	Positionals []string
+	PendingFlag string
+}
+
+// composeProject is the project addressed by the typed command, resolved from compose files and environment
+type composeProject struct {
+	Name     string
+	Services map[string]composeFileService
+	Profiles []string
+}
+
+func parseComposeArgs(args []string) composeArgs {
+	result := composeArgs{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if result.SubCommand != "" {
+			if !strings.HasPrefix(arg, "-") {
+				result.Positionals = append(result.Positionals, arg)
+				continue
+			}
+			if composeSubCommandValueFlags[result.SubCommand][arg] {
+				if i+1 >= len(args) {
+					result.PendingFlag = arg
+					break
+				}
+				i++
+			}
+			continue
+		}
+
+		if !strings.HasPrefix(arg, "-") {
+			result.SubCommand = arg
+			continue
+		}
+
+		name, value := arg, ""
+		hasValue := false
+		if index := strings.Index(arg, "="); index != -1 {
+			name, value, hasValue = arg[:index], arg[index+1:], true
+		}
+		if !composeValueFlags[name] {
+			continue
+		}
+		if !hasValue {
+			if i+1 >= len(args) {
+				result.PendingFlag = name
+				break
+			}
+			i++
+			value = args[i]
+		}
+
+		switch name {
+		case "-f", "--file":
+			result.Files = append(result.Files, value)
+		case "-p", "--project-name":
+			result.Project = value
+		case "--project-directory":
+			result.ProjectDir = value
+		}
+	}
+
+	return result
+}
+
+func composeFilesFor(args composeArgs) []string {
+	if len(args.Files) > 0 {
+		return args.Files
+	}
+
+	if env := os.Getenv("COMPOSE_FILE"); env != "" {
+		separator := os.Getenv("COMPOSE_PATH_SEPARATOR")
+		if separator == "" {
+			separator = string(os.PathListSeparator)
+		}
+		return strings.Split(env, separator)
+	}
+
+	dir := args.ProjectDir
+	if dir == "" {
+		dir, _ = os.Getwd()
+	}
+	for dir != "" {
+		for _, name := range composeDefaultFiles {
+			path := filepath.Join(dir, name)
+			if _, err := os.Stat(path); err != nil {
+				continue
+			}
+			files := []string{path}
+			for _, override := range composeOverrideFiles {
+				overridePath := filepath.Join(dir, override)
+				if _, err := os.Stat(overridePath); err == nil {
+					files = append(files, overridePath)
+					break
+				}
+			}
+			return files
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+
+	return nil
+}
+
+func normalizeComposeProjectName(name string) string {
+	return composeProjectNameExpression.ReplaceAllString(strings.ToLower(name), "")
+}
+
+func loadComposeProject(args composeArgs) composeProject {
+	project := composeProject{Services: map[string]composeFileService{}}
+	files := composeFilesFor(args)
+	profiles := map[string]bool{}
+
+	for _, file := range files {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		parsed := composeFile{}
+		if err := yaml.Unmarshal(content, &parsed); err != nil {
+			continue
+		}
+		if parsed.Name != "" {
+			project.Name = parsed.Name
+		}
+		for name, service := range parsed.Services {
+			existing := project.Services[name]
+			if service.Image != "" {
+				existing.Image = service.Image
+			}
+			existing.Profiles = append(existing.Profiles, service.Profiles...)
+			project.Services[name] = existing
+			for _, profile := range service.Profiles {
+				profiles[profile] = true
+			}
+		}
+	}
+
+	for profile := range profiles {
+		project.Profiles = append(project.Profiles, profile)
+	}
+	sort.Strings(project.Profiles)
+
+	switch {
+	case args.Project != "":
+		project.Name = args.Project
+	case os.Getenv("COMPOSE_PROJECT_NAME") != "":
+		project.Name = os.Getenv("COMPOSE_PROJECT_NAME")
+	case project.Name == "" && args.ProjectDir != "":
+		project.Name = filepath.Base(args.ProjectDir)
+	case project.Name == "" && len(files) > 0:
+		if abs, err := filepath.Abs(files[0]); err == nil {
+			project.Name = filepath.Base(filepath.Dir(abs))
+		}
+	}
+	project.Name = normalizeComposeProjectName(project.Name)
+
+	return project
+}
+
+func composeContainers(project string) []types.Container {
+	if containers, ok := objects().Containers(); ok {
+		return composeContainerFilter(containers, project)
+	}
+
+	containers := []types.Container{}
+	fetchAsync("compose-containers:"+project, 5*time.Second, sourceDeadline, &containers, func(ctx context.Context, client *docker.Client) (interface{}, error) {
+		args := filters.NewArgs()
+		if project != "" {
+			args.Add("label", composeProjectLabel+"="+project)
+		} else {
+			args.Add("label", composeProjectLabel)
+		}
+		return client.ContainerList(ctx, types.ContainerListOptions{All: true, Filters: args})
+	})
+
+	return containers
+}
+
+func composeProjectSuggestion(project composeProject) []prompt.Suggest {
+	counts := map[string]int{}
+	for _, container := range composeContainers("") {
+		if container.State == "running" {
+			counts[container.Labels[composeProjectLabel]]++
+		} else if _, ok := counts[container.Labels[composeProjectLabel]]; !ok {
+			counts[container.Labels[composeProjectLabel]] = 0
+		}
+	}
+
+	suggestions := []prompt.Suggest{}
+	if _, ok := counts[project.Name]; !ok && project.Name != "" {
+		suggestions = append(suggestions, prompt.Suggest{Text: project.Name, Description: "Project of the current compose file"})
+	}
+
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		suggestions = append(suggestions, prompt.Suggest{Text: name, Description: fmt.Sprintf("%d running container(s)", counts[name])})
+	}
+
+	return suggestions
+}
+
+func composeProfileSuggestion(project composeProject) []prompt.Suggest {
+	suggestions := []prompt.Suggest{}
+	for _, profile := range project.Profiles {
+		services := []string{}
+		for name, service := range project.Services {
+			for _, p := range service.Profiles {
+				if p == profile {
+					services = append(services, name)
+				}
+			}
+		}
+		sort.Strings(services)
+		suggestions = append(suggestions, prompt.Suggest{Text: profile, Description: "Enables " + strings.Join(services, ", ")})
+	}
+
+	return suggestions
+}
+
+func composeServiceSuggestion(project composeProject, typed []string) []prompt.Suggest {
+	running := map[string]int{}
+	images := map[string]string{}
+	for _, container := range composeContainers(project.Name) {
+		service := container.Labels[composeServiceLabel]
+		images[service] = container.Image
+		if container.State == "running" {
+			running[service]++
+		} else if _, ok := running[service]; !ok {
+			running[service] = 0
+		}
+	}
+
+	names := []string{}
+	for name := range project.Services {
+		names = append(names, name)
+	}
+	for name := range running {
+		if _, ok := project.Services[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	skip := map[string]bool{}
+	for _, name := range typed {
+		skip[name] = true
+	}
+
+	suggestions := []prompt.Suggest{}
+	for _, name := range names {
+		if skip[name] {
+			continue
+		}
+		image := project.Services[name].Image
+		if image == "" {
+			image = images[name]
+		}
+		description := image
+		if count, ok := running[name]; ok {
+			description = fmt.Sprintf("%s (%d running)", image, count)
+		}
+		suggestions = append(suggestions, prompt.Suggest{Text: name, Description: strings.TrimSpace(description)})
+	}
+
+	return suggestions
+}
+
+func composeCompleter(d prompt.Document) []prompt.Suggest {
+	word := d.GetWordBeforeCursor()
+	fields := strings.Fields(d.TextBeforeCursor())
+	if word != "" && len(fields) > 0 {
+		fields = fields[:len(fields)-1]
+	}
+	for i, field := range fields {
+		if field == "compose" {
+			fields = fields[i+1:]
+			break
+		}
+	}
+
+	args := parseComposeArgs(fields)
+	if args.PendingFlag != "" && args.SubCommand != "" {
+		return []prompt.Suggest{}
+	}
+	switch args.PendingFlag {
+	case "-p", "--project-name":
+		return prompt.FilterHasPrefix(composeProjectSuggestion(loadComposeProject(args)), word, true)
+	case "--profile":
+		return prompt.FilterHasPrefix(composeProfileSuggestion(loadComposeProject(args)), word, true)
+	case "":
+	default:
+		return []prompt.Suggest{}
+	}
+
+	if args.SubCommand == "" {
+		val, _ := shellCommands.IsDockerSubCommand("compose")
+		return prompt.FilterHasPrefix(val, word, true)
+	}
+
+	if strings.HasPrefix(word, "-") {
+		val, _ := shellCommands.IsDockerSubCommand("compose " + args.SubCommand)
+		return prompt.FilterHasPrefix(val, word, true)
+	}
+
+	single, ok := composeServiceCommands[args.SubCommand]
+	if !ok || (single && len(args.Positionals) > 0) {
+		return []prompt.Suggest{}
+	}
+
+	return prompt.FilterHasPrefix(composeServiceSuggestion(loadComposeProject(args), args.Positionals), word, true)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseComposeArgs(t *testing.T) {
+	for _, test := range []struct {
+		line string
+		want composeArgs
+	}{
+		{"", composeArgs{}},
+		{"-f a.yml --file=b.yml -p demo up", composeArgs{Files: []string{"a.yml", "b.yml"}, Project: "demo", SubCommand: "up"}},
+		{"--project-directory ./app --ansi never ps web", composeArgs{ProjectDir: "./app", SubCommand: "ps", Positionals: []string{"web"}}},
+		{"--profile", composeArgs{PendingFlag: "--profile"}},
+		{"exec --user root web", composeArgs{SubCommand: "exec", Positionals: []string{"web"}}},
+		{"exec -u root -w /app web sh", composeArgs{SubCommand: "exec", Positionals: []string{"web", "sh"}}},
+		{"logs --tail 10 -f web db", composeArgs{SubCommand: "logs", Positionals: []string{"web", "db"}}},
+		{"logs --tail=10 web", composeArgs{SubCommand: "logs", Positionals: []string{"web"}}},
+		{"logs --tail", composeArgs{SubCommand: "logs", PendingFlag: "--tail"}},
+		{"run -p 8080:80 --rm web", composeArgs{SubCommand: "run", Positionals: []string{"web"}}},
+		{"up -d --scale web=3 web", composeArgs{SubCommand: "up", Positionals: []string{"web"}}},
+	} {
+		if got := parseComposeArgs(strings.Fields(test.line)); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: got %+v, want %+v", test.line, got, test.want)
+		}
+	}
+}
+
+func TestComposeCompleterSkipsFlagValues(t *testing.T) {
+	defer useFakeDaemon(t, fakeDaemonSize{})()
+	file, err := ioutil.TempFile("", "compose*.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString("services:\n  web:\n    image: nginx\n  db:\n    image: postgres\n")
+	file.Close()
+	previous, set := os.LookupEnv("COMPOSE_FILE")
+	os.Setenv("COMPOSE_FILE", file.Name())
+	defer func() {
+		if set {
+			os.Setenv("COMPOSE_FILE", previous)
+		} else {
+			os.Unsetenv("COMPOSE_FILE")
+		}
+	}()
+
+	for line, want := range map[string]int{
+		"compose exec --user root ":     2,
+		"compose logs --tail 10 ":       2,
+		"compose exec --user ":          0,
+		"compose run -p ":               0,
+		"compose exec --user root web ": 0,
+	} {
+		if suggestions := composeCompleter(documentOf(line, len(line))); len(suggestions) != want {
+			t.Errorf("%q: got %v, want %d services", line, suggestions, want)
+		}
+	}
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	docker "docker.io/go-docker"
+	"docker.io/go-docker/api"
+	"github.com/c-bata/go-prompt"
+)
+
+// defaultContextName is the context the docker CLI builds from DOCKER_HOST and the TLS variables
+const defaultContextName = "default"
+
+// dockerContext is a docker endpoint of ~/.docker/contexts
+type dockerContext struct {
+	Name          string
+	Description   string
+	Host          string
+	SkipTLSVerify bool
+	// TLSDir holds ca.pem, cert.pem and key.pem when the endpoint uses TLS
+	TLSDir string
+}
+
+// contextMetadata is the meta.json of a context, only the docker endpoint matters to the shell
+type contextMetadata struct {
+	Name     string `json:"Name"`
+	Metadata struct {
+		Description string `json:"Description"`
+	} `json:"Metadata"`
+	Endpoints map[string]struct {
+		Host          string `json:"Host"`
+		SkipTLSVerify bool   `json:"SkipTLSVerify"`
+	} `json:"Endpoints"`
+}
+
+// daemonConnection is the daemon the shell talks to: its client, the context it was opened from, the engine
+// commands are run with and the object model following it
+type daemonConnection struct {
+	client  *docker.Client
+	context string
+	// engine names the CLI binary
+	engine  string
+	objects *objectModel
+	// stop ends the watch of objects
+	stop context.CancelFunc
+}
+
+// connection is replaced by context switches and the health monitor while completion reads it, it is only
+// accessed under its lock
+var connection = struct {
+	sync.RWMutex
+	daemonConnection
+}{daemonConnection: daemonConnection{context: defaultContextName, engine: engineDocker, objects: &objectModel{}, stop: func() {}}}
+
+// currentConnection returns a snapshot of the connection
+func currentConnection() daemonConnection {
+	connection.RLock()
+	defer connection.RUnlock()
+
+	return connection.daemonConnection
+}
+
+// swapConnection replaces the connection and returns the previous one
+func swapConnection(next daemonConnection) daemonConnection {
+	connection.Lock()
+	defer connection.Unlock()
+
+	previous := connection.daemonConnection
+	connection.daemonConnection = next
+	return previous
+}
+
+// dockerClient returns the client of the daemon the shell is connected to
+func dockerClient() *docker.Client {
+	return currentConnection().client
+}
+
+// activeContext returns the context the shell is connected to
+func activeContext() string {
+	return currentConnection().context
+}
+
+// activeEngine returns the engine commands are run with
+func activeEngine() string {
+	return currentConnection().engine
+}
+
+// contextDirName is how the docker CLI names the directories of a context
+func contextDirName(name string) string {
+	sum := sha256.Sum256([]byte(name))
+	return hex.EncodeToString(sum[:])
+}
+
+func defaultDockerContext() dockerContext {
+	host := os.Getenv("DOCKER_HOST")
+	if host == "" {
+		host = defaultEngineHost()
+	}
+
+	return dockerContext{Name: defaultContextName, Description: "Current DOCKER_HOST based configuration", Host: host}
+}
+
+// loadDockerContexts returns the default context followed by the contexts of ~/.docker/contexts sorted by name
+func loadDockerContexts() ([]dockerContext, error) {
+	contexts := []dockerContext{defaultDockerContext()}
+
+	metaDir := filepath.Join(dockerConfigDir(), "contexts", "meta")
+	entries, err := ioutil.ReadDir(metaDir)
+	if os.IsNotExist(err) {
+		return contexts, nil
+	}
+	if err != nil {
+		return contexts, err
+	}
+
+	loaded := []dockerContext{}
+	for _, entry := range entries {
+		content, err := ioutil.ReadFile(filepath.Join(metaDir, entry.Name(), "meta.json"))
+		if err != nil {
+			continue
+		}
+		meta := contextMetadata{}
+		if err := json.Unmarshal(content, &meta); err != nil {
+			return contexts, fmt.Errorf("%s: %v", entry.Name(), err)
+		}
+		endpoint, ok := meta.Endpoints["docker"]
+		if !ok || meta.Name == "" {
+			continue
+		}
+
+		dockerCtx := dockerContext{Name: meta.Name, Description: meta.Metadata.Description, Host: endpoint.Host, SkipTLSVerify: endpoint.SkipTLSVerify}
+		tlsDir := filepath.Join(dockerConfigDir(), "contexts", "tls", contextDirName(meta.Name), "docker")
+		if _, err := os.Stat(tlsDir); err == nil {
+			dockerCtx.TLSDir = tlsDir
+		}
+		loaded = append(loaded, dockerCtx)
+	}
+	sort.Slice(loaded, func(i, j int) bool { return loaded[i].Name < loaded[j].Name })
+
+	return append(contexts, loaded...), nil
+}
+
+// currentContextName picks the context like the docker CLI: DOCKER_CONTEXT, then DOCKER_HOST which selects
+// the default context, then the currentContext of config.json
+func currentContextName() string {
+	if name := os.Getenv("DOCKER_CONTEXT"); name != "" {
+		return name
+	}
+	if os.Getenv("DOCKER_HOST") != "" {
+		return defaultContextName
+	}
+	if name := loadDockerConfig().CurrentContext; name != "" {
+		return name
+	}
+
+	return defaultContextName
+}
+
+func findDockerContext(name string) (dockerContext, error) {
+	contexts, err := loadDockerContexts()
+	for _, dockerCtx := range contexts {
+		if dockerCtx.Name == name {
+			return dockerCtx, nil
+		}
+	}
+	if err != nil {
+		return dockerContext{}, err
+	}
+
+	return dockerContext{}, fmt.Errorf("context %q does not exist", name)
+}
+
+// contextTLSConfig loads the certificates of a context, nil means plain TCP or a socket
+func contextTLSConfig(dockerCtx dockerContext) (*tls.Config, error) {
+	if dockerCtx.TLSDir == "" && !dockerCtx.SkipTLSVerify {
+		return nil, nil
+	}
+
+	config := &tls.Config{InsecureSkipVerify: dockerCtx.SkipTLSVerify}
+	if dockerCtx.TLSDir == "" {
+		return config, nil
+	}
+
+	if ca, err := ioutil.ReadFile(filepath.Join(dockerCtx.TLSDir, "ca.pem")); err == nil {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("%s: no certificate found in ca.pem", dockerCtx.Name)
+		}
+		config.RootCAs = pool
+	}
+	certFile, keyFile := filepath.Join(dockerCtx.TLSDir, "cert.pem"), filepath.Join(dockerCtx.TLSDir, "key.pem")
+	if _, err := os.Stat(certFile); err == nil {
+		certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", dockerCtx.Name, err)
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+
+	return config, nil
+}
+
+// newContextClient creates a client for the endpoint of a context. The default context is left to
+// NewEnvClient, which honours DOCKER_HOST, DOCKER_TLS_VERIFY and DOCKER_CERT_PATH, unless a podman socket was found.
+func newContextClient(dockerCtx dockerContext) (*docker.Client, error) {
+	if strings.HasPrefix(dockerCtx.Host, "ssh://") {
+		return newSSHClient(dockerCtx.Host)
+	}
+	if dockerCtx.Name == defaultContextName && (os.Getenv("DOCKER_HOST") != "" || dockerCtx.Host == docker.DefaultDockerHost) {
+		return docker.NewEnvClient()
+	}
+
+	version := pinnedAPIVersion()
+	if version == "" {
+		version = api.DefaultVersion
+	}
+
+	tlsConfig, err := contextTLSConfig(dockerCtx)
+	if err != nil {
+		return nil, err
+	}
+	var httpClient *http.Client
+	if tlsConfig != nil {
+		httpClient = &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	}
+
+	return docker.NewClient(dockerCtx.Host, version, httpClient, nil)
+}
+
+// connectLock serializes switching contexts with reconnections of the health monitor
+var connectLock sync.Mutex
+
+// openContext creates a client for a context without contacting the daemon
+func openContext(name string) (*docker.Client, dockerContext, error) {
+	dockerCtx, err := findDockerContext(name)
+	if err != nil {
+		return nil, dockerCtx, err
+	}
+	client, err := newContextClient(dockerCtx)
+
+	return client, dockerCtx, err
+}
+
+// connectContext points the shell at the daemon of a context once it answers. Completion data of the previous
+// daemon is dropped and the object model follows the new one.
+func connectContext(name string) error {
+	connectLock.Lock()
+	defer connectLock.Unlock()
+
+	return connectLocked(name)
+}
+
+// reconnectContext connects the shell to the context it is using again. The context is read under connectLock,
+// a reconnection waiting for a context switch reconnects to the new context rather than undoing the switch.
+func reconnectContext() error {
+	connectLock.Lock()
+	defer connectLock.Unlock()
+
+	return connectLocked(activeContext())
+}
+
+// connectLocked is connectContext for a caller holding connectLock
+func connectLocked(name string) error {
+	client, dockerCtx, err := openContext(name)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), healthPingDeadline)
+	defer cancel()
+	ping, err := client.Ping(ctx)
+	if err != nil {
+		client.Close()
+		return err
+	}
+
+	version := negotiateAPIVersion(ctx, client, ping)
+	useClient(client, dockerCtx.Name, detectEngine(dockerCtx.Host, version))
+	loadDaemonRegistries(ctx, client)
+	health.record(nil)
+
+	return nil
+}
+
+// useClient connects the shell to client and starts over everything loaded from the previous daemon. The event
+// stream and the loads of the previous daemon are cancelled before its client is closed.
+func useClient(client *docker.Client, name string, engine string) {
+	ctx, stop := context.WithCancel(context.Background())
+	model := &objectModel{client: client}
+	previous := swapConnection(daemonConnection{client: client, context: name, engine: engine, objects: model, stop: stop})
+	shellCommands.SetEngine(engine)
+
+	previous.stop()
+	resetSources(client)
+	if previous.client != nil {
+		previous.client.Close()
+	}
+	go model.watch(ctx)
+}
+
+// dockerCLI runs the CLI of the engine, the docker CLI against the context the shell is connected to
+func dockerCLI(args ...string) *exec.Cmd {
+	current := currentConnection()
+	if current.engine == engineDocker && current.context != currentContextName() {
+		args = append([]string{"--context", current.context}, args...)
+	}
+
+	return exec.Command(current.engine, args...)
+}
+
+// contextIndicator shows the context in the prompt unless it is the default one
+func contextIndicator() string {
+	name := activeContext()
+	if name == defaultContextName {
+		return ""
+	}
+
+	return "[" + name + "] "
+}
+
+func contextSuggestion() ([]prompt.Suggest, error) {
+	contexts, err := loadDockerContexts()
+	active := activeContext()
+	suggestions := []prompt.Suggest{}
+	for _, dockerCtx := range contexts {
+		description := dockerCtx.Host
+		if dockerCtx.Description != "" {
+			description = dockerCtx.Description + ", " + dockerCtx.Host
+		}
+		if dockerCtx.Name == active {
+			description = "(active) " + description
+		}
+		suggestions = append(suggestions, prompt.Suggest{Text: dockerCtx.Name, Description: description})
+	}
+
+	return suggestions, err
+}
+
+// contextUseBuiltin switches the context of the session only, unlike `docker context use` it leaves
+// config.json alone
+func contextUseBuiltin(args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage:", shellCommands.Usage("context use"))
+		return
+	}
+
+	if err := connectContext(args[0]); err != nil {
+		fmt.Fprintln(os.Stderr, "context use:", err)
+		return
+	}
+	fmt.Println("Switched to context", activeContext())
+}
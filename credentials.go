@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// credentialHelperPrefix is prepended to credsStore/credHelpers names to find the helper binary on PATH
+	credentialHelperPrefix = "docker-credential-"
+	// identityTokenUsername is the username helpers and config.json use for identity (refresh) tokens
+	identityTokenUsername = "<token>"
+	dockerHubServerURL    = "https://index.docker.io/v1/"
+)
+
+// credentialHelperResponse is the answer of `docker-credential-<name> get`
+type credentialHelperResponse struct {
+	ServerURL string
+	Username  string
+	Secret    string
+}
+
+// credentialHelperGet runs the credential helper protocol: the server URL is written to the
+// standard input of `docker-credential-<helper> get` which answers with the credentials as JSON
+func credentialHelperGet(helper string, serverURL string) (string, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stderr := &bytes.Buffer{}
+	cmd := exec.CommandContext(ctx, credentialHelperPrefix+helper, "get")
+	cmd.Stdin = strings.NewReader(serverURL)
+	cmd.Stderr = stderr
+	output, err := cmd.Output()
+	if err != nil {
+		message := strings.TrimSpace(string(output) + stderr.String())
+		if message == "" {
+			message = err.Error()
+		}
+		return "", "", fmt.Errorf("%s%s: %s", credentialHelperPrefix, helper, message)
+	}
+
+	response := credentialHelperResponse{}
+	if err := json.Unmarshal(output, &response); err != nil {
+		return "", "", fmt.Errorf("%s%s: invalid response: %v", credentialHelperPrefix, helper, err)
+	}
+
+	return response.Username, response.Secret, nil
+}
+
+// configKeysFor returns the config.json keys naming a registry host in the order they are tried: the host
+// itself, then the keys naming it with a scheme or path, then the other Docker Hub aliases
+func configKeysFor(keys []string, host string) []string {
+	rank := func(key string) int {
+		switch {
+		case key == host:
+			return 0
+		case registryHost(key) == host:
+			return 1
+		case dockerHubRegistries[host] && (dockerHubRegistries[key] || dockerHubRegistries[registryHost(key)]):
+			return 2
+		default:
+			return -1
+		}
+	}
+
+	matches := []string{}
+	for _, key := range keys {
+		if rank(key) != -1 {
+			matches = append(matches, key)
+		}
+	}
+	sort.Strings(matches)
+	sort.SliceStable(matches, func(i, j int) bool { return rank(matches[i]) < rank(matches[j]) })
+
+	return matches
+}
+
+// credentialHelperFor returns the helper configured for a registry host, like the docker CLI:
+// a per registry credHelpers entry wins over the global credsStore
+func credentialHelperFor(config dockerConfigFile, host string) string {
+	keys := []string{}
+	for key := range config.CredHelpers {
+		keys = append(keys, key)
+	}
+	if matches := configKeysFor(keys, host); len(matches) > 0 {
+		return config.CredHelpers[matches[0]]
+	}
+
+	return config.CredsStore
+}
+
+// registryCredentials returns the username and password of a registry from its credential helper or config.json
+func registryCredentials(config dockerConfigFile, host string) (string, string) {
+	if helper := credentialHelperFor(config, host); helper != "" {
+		serverURL := host
+		if dockerHubRegistries[host] {
+			serverURL = dockerHubServerURL
+		}
+		if username, secret, err := credentialHelperGet(helper, serverURL); err == nil {
+			return username, secret
+		}
+	}
+
+	keys := []string{}
+	for key := range config.Auths {
+		keys = append(keys, key)
+	}
+	for _, key := range configKeysFor(keys, host) {
+		auth := config.Auths[key]
+		if auth.IdentityToken != "" {
+			return identityTokenUsername, auth.IdentityToken
+		}
+		if auth.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+			if err == nil {
+				parts := strings.SplitN(string(decoded), ":", 2)
+				if len(parts) == 2 {
+					return parts[0], parts[1]
+				}
+			}
+		}
+		return auth.Username, auth.Password
+	}
+
+	return "", ""
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// credentialHelperStandIn makes the test binary act as a credential helper
+const credentialHelperStandIn = "DOCKER_SHELL_TEST_CREDENTIAL_HELPER"
+
+// TestCredentialHelperStandIn isn't a test, it is the docker-credential-<name> helper run by the tests below.
+// It answers with credentials naming the helper and the server, servers containing "missing" aren't found.
+func TestCredentialHelperStandIn(t *testing.T) {
+	if os.Getenv(credentialHelperStandIn) == "" {
+		return
+	}
+	helper, action := os.Args[len(os.Args)-2], os.Args[len(os.Args)-1]
+	serverURL, _ := ioutil.ReadAll(os.Stdin)
+	if action != "get" || strings.Contains(string(serverURL), "missing") {
+		fmt.Print("credentials not found in native keychain")
+		os.Exit(1)
+	}
+
+	json.NewEncoder(os.Stdout).Encode(credentialHelperResponse{
+		ServerURL: string(serverURL),
+		Username:  helper + "@" + string(serverURL),
+		Secret:    helper + "-secret",
+	})
+	os.Exit(0)
+}
+
+// useCredentialHelpers puts docker-credential-<name> helpers backed by the test binary first on PATH
+func useCredentialHelpers(t *testing.T, names ...string) func() {
+	dir, err := ioutil.TempDir("", "docker-shell-credentials")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		script := fmt.Sprintf("#!/bin/sh\nexec %q -test.run='^TestCredentialHelperStandIn$' -- %s \"$@\"\n", os.Args[0], name)
+		if err := ioutil.WriteFile(filepath.Join(dir, credentialHelperPrefix+name), []byte(script), 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	previousPath := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+previousPath)
+	os.Setenv(credentialHelperStandIn, "1")
+	return func() {
+		os.Setenv("PATH", previousPath)
+		os.Unsetenv(credentialHelperStandIn)
+		os.RemoveAll(dir)
+	}
+}
+
+func TestRegistryCredentials(t *testing.T) {
+	defer useCredentialHelpers(t, "team", "store")()
+
+	basic := base64.StdEncoding.EncodeToString([]byte("alice:s3cret"))
+	config := dockerConfigFile{
+		CredsStore:  "store",
+		CredHelpers: map[string]string{"registry.example.com": "team", "missing.example.com": "team"},
+		Auths:       map[string]dockerAuthConfig{"https://missing.example.com/v1/": {Auth: basic}},
+	}
+	plain := dockerConfigFile{Auths: map[string]dockerAuthConfig{
+		"missing.example.com": {Auth: basic},
+		"ghcr.io":             {Username: "bob", Password: "pat"},
+		"quay.io":             {IdentityToken: "refresh-token"},
+	}}
+
+	for _, test := range []struct {
+		name     string
+		config   dockerConfigFile
+		host     string
+		username string
+		password string
+	}{
+		{"credHelpers wins over credsStore", config, "registry.example.com", "team@registry.example.com", "team-secret"},
+		{"credsStore", config, "other.example.com", "store@other.example.com", "store-secret"},
+		{"Docker Hub server URL", config, "docker.io", "store@" + dockerHubServerURL, "store-secret"},
+		{"helper failure falls back to auths", config, "missing.example.com", "alice", "s3cret"},
+		{"auths basic", plain, "missing.example.com", "alice", "s3cret"},
+		{"auths username and password", plain, "ghcr.io", "bob", "pat"},
+		{"auths identity token", plain, "quay.io", identityTokenUsername, "refresh-token"},
+		{"unknown registry", plain, "registry.example.com", "", ""},
+	} {
+		username, password := registryCredentials(test.config, test.host)
+		if username != test.username || password != test.password {
+			t.Errorf("%s: got %q/%q, want %q/%q", test.name, username, password, test.username, test.password)
+		}
+	}
+}
+
+func TestCredentialHelperErrors(t *testing.T) {
+	defer useCredentialHelpers(t, "store")()
+
+	if _, _, err := credentialHelperGet("store", "missing.example.com"); err == nil || err.Error() != "docker-credential-store: credentials not found in native keychain" {
+		t.Errorf("unexpected error %v", err)
+	}
+	if _, _, err := credentialHelperGet("absent", "registry.example.com"); err == nil || !strings.HasPrefix(err.Error(), "docker-credential-absent: ") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+// several config.json keys can name the same registry, the one picked doesn't depend on map order
+func TestCredentialHelperForPrefersTheExactHost(t *testing.T) {
+	config := dockerConfigFile{
+		CredsStore: "store",
+		CredHelpers: map[string]string{
+			"registry.example.com":            "exact",
+			"https://registry.example.com":    "scheme",
+			"registry.example.com/v1/":        "path",
+			"https://index.docker.io/v1/":     "hub-url",
+			"index.docker.io":                 "hub-index",
+			"registry-1.docker.io":            "hub-registry",
+			"https://registry.other.example/": "other",
+		},
+	}
+
+	for _, test := range []struct {
+		host string
+		want string
+	}{
+		{"registry.example.com", "exact"},
+		{"registry.other.example", "other"},
+		{"index.docker.io", "hub-index"},
+		{"docker.io", "hub-url"},
+		{"unknown.example.com", "store"},
+	} {
+		for i := 0; i < 20; i++ {
+			if got := credentialHelperFor(config, test.host); got != test.want {
+				t.Errorf("%s: got %q, want %q", test.host, got, test.want)
+				break
+			}
+		}
+	}
+
+	delete(config.CredHelpers, "registry.example.com")
+	if got := credentialHelperFor(config, "registry.example.com"); got != "scheme" {
+		t.Errorf("without the exact host the first key in order should win, got %q", got)
+	}
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+)
+
+// cacheEntry is what the suggestion cache keeps in memory and writes to disk for a key
+type cacheEntry struct {
+	Key    string          `json:"key"`
+	Stored time.Time       `json:"stored"`
+	Value  json.RawMessage `json:"value"`
+}
+
+// suggestionCache keeps completion data in memory and on disk so it survives restarts and works offline.
+// Entries older than their freshness are served as they are while being refreshed in the background.
+type suggestionCache struct {
+	dir    string
+	memory *cache.Cache
+
+	lock       sync.Mutex
+	refreshing map[string]bool
+	hits       int
+	stale      int
+	misses     int
+	failures   int
+}
+
+func newSuggestionCache(dir string) *suggestionCache {
+	if dir != "" {
+		os.MkdirAll(dir, 0700)
+	}
+
+	return &suggestionCache{
+		dir:        dir,
+		memory:     cache.New(cache.NoExpiration, 10*time.Minute),
+		refreshing: map[string]bool{},
+	}
+}
+
+// cacheDir returns the XDG cache directory of the shell
+func cacheDir() string {
+	base := os.Getenv("XDG_CACHE_HOME")
+	if base == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		base = filepath.Join(home, ".cache")
+	}
+
+	return filepath.Join(base, "docker-shell")
+}
+
+var completionCache = newSuggestionCache(cacheDir())
+
+func (c *suggestionCache) path(key string) string {
+	sum := sha1.Sum([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+func (c *suggestionCache) lookup(key string) (cacheEntry, bool) {
+	if cached, found := c.memory.Get(key); found {
+		return cached.(cacheEntry), true
+	}
+
+	if c.dir == "" {
+		return cacheEntry{}, false
+	}
+	content, err := ioutil.ReadFile(c.path(key))
+	if err != nil {
+		return cacheEntry{}, false
+	}
+	entry := cacheEntry{}
+	if err := json.Unmarshal(content, &entry); err != nil || entry.Key != key {
+		return cacheEntry{}, false
+	}
+	c.memory.Set(key, entry, cache.NoExpiration)
+
+	return entry, true
+}
+
+// Store saves value under key in memory and on disk
+func (c *suggestionCache) Store(key string, value interface{}) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	entry := cacheEntry{Key: key, Stored: time.Now(), Value: raw}
+	c.memory.Set(key, entry, cache.NoExpiration)
+	if c.dir == "" {
+		return nil
+	}
+
+	content, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	// every writer gets its own temporary file, concurrent stores of a key each rename a complete entry
+	temporary, err := ioutil.TempFile(c.dir, filepath.Base(c.path(key))+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = temporary.Write(content)
+	if closeErr := temporary.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(temporary.Name())
+		return err
+	}
+
+	return os.Rename(temporary.Name(), c.path(key))
+}
+
+// Peek decodes the cached value of key into target without loading or refreshing it
+func (c *suggestionCache) Peek(key string, target interface{}) bool {
+	entry, found := c.lookup(key)
+	return found && json.Unmarshal(entry.Value, target) == nil
+}
+
+// Age returns how long ago the entry of key was stored
+func (c *suggestionCache) Age(key string) (time.Duration, bool) {
+	entry, found := c.lookup(key)
+	if !found {
+		return 0, false
+	}
+
+	return time.Since(entry.Stored), true
+}
+
+// cached decodes the entry of key into target, reloading it in the background when it is older than fresh
+func (c *suggestionCache) cached(key string, fresh time.Duration, target interface{}, load func() (interface{}, error)) bool {
+	entry, found := c.lookup(key)
+	if !found || json.Unmarshal(entry.Value, target) != nil {
+		return false
+	}
+
+	c.lock.Lock()
+	if time.Since(entry.Stored) < fresh {
+		c.hits++
+		c.lock.Unlock()
+		return true
+	}
+	c.stale++
+	refreshing := c.refreshing[key]
+	c.refreshing[key] = true
+	c.lock.Unlock()
+
+	if !refreshing {
+		go c.refresh(key, load)
+	}
+	return true
+}
+
+// Fetch decodes the cached value of key into target. A missing entry is loaded synchronously,
+// an entry older than fresh is returned immediately and reloaded in the background.
+func (c *suggestionCache) Fetch(key string, fresh time.Duration, target interface{}, load func() (interface{}, error)) bool {
+	if c.cached(key, fresh, target, load) {
+		return true
+	}
+
+	c.lock.Lock()
+	c.misses++
+	c.lock.Unlock()
+
+	value, err := load()
+	if err != nil {
+		c.lock.Lock()
+		c.failures++
+		c.lock.Unlock()
+		return false
+	}
+	c.Store(key, value)
+	raw, _ := json.Marshal(value)
+
+	return json.Unmarshal(raw, target) == nil
+}
+
+// FetchAsync is Fetch for completers: a missing entry is loaded in the background and the dropdown
+// is refreshed once it arrives, meanwhile false is returned
+func (c *suggestionCache) FetchAsync(key string, fresh time.Duration, target interface{}, load func() (interface{}, error)) bool {
+	if c.cached(key, fresh, target, load) {
+		return true
+	}
+
+	c.lock.Lock()
+	c.misses++
+	refreshing := c.refreshing[key]
+	c.refreshing[key] = true
+	c.lock.Unlock()
+
+	if !refreshing {
+		go func() {
+			c.refresh(key, load)
+			completionEngine.refresh()
+		}()
+	}
+	return false
+}
+
+func (c *suggestionCache) refresh(key string, load func() (interface{}, error)) {
+	defer func() {
+		c.lock.Lock()
+		if recover() != nil {
+			// a panicking loader counts as a failure, the background goroutine must not crash the shell
+			c.failures++
+		}
+		delete(c.refreshing, key)
+		c.lock.Unlock()
+	}()
+
+	value, err := load()
+	if err != nil {
+		c.lock.Lock()
+		c.failures++
+		c.lock.Unlock()
+		return
+	}
+	c.Store(key, value)
+}
+
+// Clear removes every entry from memory and disk
+func (c *suggestionCache) Clear() (int, error) {
+	c.memory.Flush()
+	if c.dir == "" {
+		return 0, nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(c.dir, "*.json"))
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, file := range files {
+		if os.Remove(file) == nil {
+			removed++
+		}
+	}
+
+	// leftovers of writes interrupted before their rename
+	temporaries, _ := filepath.Glob(filepath.Join(c.dir, "*.tmp"))
+	for _, file := range temporaries {
+		os.Remove(file)
+	}
+
+	return removed, nil
+}
+
+// Stats describes the cache content and how it has been used in this session
+func (c *suggestionCache) Stats() string {
+	entries, size := 0, int64(0)
+	oldest := time.Time{}
+	if files, err := filepath.Glob(filepath.Join(c.dir, "*.json")); err == nil {
+		for _, file := range files {
+			info, err := os.Stat(file)
+			if err != nil {
+				continue
+			}
+			entries++
+			size += info.Size()
+			if oldest.IsZero() || info.ModTime().Before(oldest) {
+				oldest = info.ModTime()
+			}
+		}
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	lines := []string{
+		fmt.Sprintf("Directory:   %s", c.dir),
+		fmt.Sprintf("Entries:     %d on disk (%s), %d in memory", entries, humanizeCount(size)+"B", c.memory.ItemCount()),
+		fmt.Sprintf("Fresh hits:  %d", c.hits),
+		fmt.Sprintf("Stale hits:  %d (%d refreshing)", c.stale, len(c.refreshing)),
+		fmt.Sprintf("Misses:      %d (%d failed)", c.misses, c.failures),
+	}
+	if !oldest.IsZero() {
+		lines = append(lines, fmt.Sprintf("Oldest:      %s", oldest.Format(time.RFC3339)))
+	}
+
+	return strings.Join(lines, "\n")
+}
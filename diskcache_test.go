@@ -0,0 +1,48 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestSuggestionCacheConcurrentStores(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-shell-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writer := newSuggestionCache(dir)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := writer.Store("images", []string{strconv.Itoa(i)}); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// a new cache reads the entry back from disk
+	value := []string{}
+	if !newSuggestionCache(dir).Peek("images", &value) || len(value) != 1 {
+		t.Fatalf("the stored entry can't be read back: %v", value)
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(dir, "*.tmp")); len(leftovers) != 0 {
+		t.Errorf("temporary files are left behind: %v", leftovers)
+	}
+
+	ioutil.WriteFile(filepath.Join(dir, "interrupted.json.123.tmp"), []byte("{"), 0600)
+	if removed, err := writer.Clear(); err != nil || removed != 1 {
+		t.Errorf("Clear removed %d entries: %v", removed, err)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("files are left after Clear: %d", len(files))
+	}
+}
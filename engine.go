@@ -0,0 +1,105 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	docker "docker.io/go-docker"
+	"docker.io/go-docker/api/types"
+)
+
+const (
+	engineAuto   = "auto"
+	engineDocker = "docker"
+	enginePodman = "podman"
+)
+
+var engineFlag = flag.String("engine", "", "container engine: docker, podman or auto to detect it from the daemon (default from settings)")
+
+// configuredEngine returns the engine asked for with --engine, DOCKER_SHELL_ENGINE or the settings
+func configuredEngine() (string, error) {
+	engine := settings.Engine
+	if *engineFlag != "" {
+		engine = *engineFlag
+	}
+
+	switch engine {
+	case engineAuto, engineDocker, enginePodman:
+		return engine, nil
+	}
+
+	return engineAuto, fmt.Errorf("unknown engine %q, expected auto, docker or podman", engine)
+}
+
+// podmanSockets are the sockets of Podman's Docker compatible API, rootless first
+func podmanSockets() []string {
+	sockets := []string{}
+	if runtime := os.Getenv("XDG_RUNTIME_DIR"); runtime != "" {
+		sockets = append(sockets, filepath.Join(runtime, "podman", "podman.sock"))
+	}
+
+	return append(sockets, "/run/podman/podman.sock")
+}
+
+// defaultEngineHost finds the daemon when neither DOCKER_HOST nor a context names one. Podman is used when it is
+// asked for, or in auto mode when there is no docker socket but a podman one.
+func defaultEngineHost() string {
+	engine, _ := configuredEngine()
+	if engine == engineDocker {
+		return docker.DefaultDockerHost
+	}
+	if engine == enginePodman {
+		if host := os.Getenv("CONTAINER_HOST"); host != "" {
+			return host
+		}
+	}
+	if engine == engineAuto && socketExists(docker.DefaultDockerHost) {
+		return docker.DefaultDockerHost
+	}
+
+	for _, socket := range podmanSockets() {
+		if socketExists("unix://" + socket) {
+			return "unix://" + socket
+		}
+	}
+
+	return docker.DefaultDockerHost
+}
+
+func socketExists(host string) bool {
+	_, err := os.Stat(strings.TrimPrefix(host, "unix://"))
+	return err == nil
+}
+
+// isPodman tells whether the version of a daemon is Podman's Docker compatible API
+func isPodman(version types.Version) bool {
+	for _, component := range version.Components {
+		if strings.Contains(strings.ToLower(component.Name), "podman") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// detectEngine picks the engine for the daemon the shell connects to. An engine set with --engine or the settings
+// wins over detection, version is empty when the daemon didn't answer.
+func detectEngine(host string, version types.Version) string {
+	engine, _ := configuredEngine()
+	if engine == engineAuto {
+		engine = engineDocker
+		if isPodman(version) || (version.Version == "" && strings.Contains(host, "podman")) {
+			engine = enginePodman
+		}
+	}
+
+	return engine
+}
+
+// promptPrefix names the engine commands are run with
+func promptPrefix() string {
+	return ">>> " + activeEngine() + " "
+}
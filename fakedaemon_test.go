@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	docker "docker.io/go-docker"
+	"docker.io/go-docker/api/types"
+	"docker.io/go-docker/api/types/swarm"
+	volumetypes "docker.io/go-docker/api/types/volume"
+	commands "github.com/mstrYoda/docker-shell/lib"
+)
+
+// apiVersionPrefix is the /v1.xx prefix the client puts in front of every Engine API path
+var apiVersionPrefix = regexp.MustCompile(`^/v1\.[0-9]+`)
+
+// fakeDaemon serves the part of the Docker Engine API completion reads, and the Docker Hub search,
+// from generated objects
+type fakeDaemon struct {
+	containers  []types.Container
+	images      []types.ImageSummary
+	inspections map[string]map[string]interface{}
+	networks    []types.NetworkResource
+	volumes     []*types.Volume
+	services    []swarm.Service
+	tasks       []swarm.Task
+	nodes       []swarm.Node
+	hub         []hubRepository
+	// apiVersion is the API version the daemon answers pings with, none when empty
+	apiVersion string
+}
+
+// fakeDaemonSize is the number of objects of each kind a fake daemon holds
+type fakeDaemonSize struct {
+	Containers, Images, Networks, Volumes int
+	// Services and Nodes make the fake daemon a swarm manager
+	Services, Nodes int
+}
+
+// largeHost is a busy CI runner or a developer machine which never prunes
+var largeHost = fakeDaemonSize{Containers: 5000, Images: 2000, Networks: 200, Volumes: 1000}
+
+// fakeID returns a 64 hex digit id, kind keeps the ids of different object kinds apart
+func fakeID(kind byte, i int) string {
+	return fmt.Sprintf("%02x%062x", kind, i)
+}
+
+func newFakeDaemon(size fakeDaemonSize) *fakeDaemon {
+	daemon := &fakeDaemon{inspections: map[string]map[string]interface{}{}}
+	created := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	repositories := []string{"nginx", "redis", "postgres", "node", "golang", "alpine", "mstryoda/docker-shell", "registry.example.com/team/api"}
+
+	for i := 0; i < size.Images; i++ {
+		id := "sha256:" + fakeID('i', i)
+		image := types.ImageSummary{ID: id, Created: created.Add(time.Duration(i) * time.Minute).Unix(), Size: int64(i+1) << 20}
+		// every tenth image is a dangling build layer
+		if i%10 != 9 {
+			repository := repositories[i%len(repositories)]
+			image.RepoTags = []string{fmt.Sprintf("%s:1.%d", repository, i)}
+			image.RepoDigests = []string{fmt.Sprintf("%s@sha256:%064x", repository, i)}
+		} else {
+			image.RepoTags = []string{"<none>:<none>"}
+		}
+		daemon.images = append(daemon.images, image)
+
+		exposed := map[string]struct{}{}
+		if i%3 == 0 {
+			exposed[fmt.Sprintf("%d/tcp", 8000+i%100)] = struct{}{}
+		}
+		daemon.inspections[id] = map[string]interface{}{
+			"Id":          id,
+			"RepoTags":    image.RepoTags,
+			"RepoDigests": image.RepoDigests,
+			"Created":     time.Unix(image.Created, 0).UTC().Format(time.RFC3339Nano),
+			"Size":        image.Size,
+			"Config":      map[string]interface{}{"ExposedPorts": exposed},
+		}
+		// the daemon resolves tags too
+		if i%10 != 9 {
+			daemon.inspections[image.RepoTags[0]] = daemon.inspections[id]
+		}
+	}
+
+	for i := 0; i < size.Containers; i++ {
+		container := types.Container{
+			ID:      fakeID('c', i),
+			Names:   []string{fmt.Sprintf("/service_%d", i)},
+			Created: created.Add(time.Duration(i) * time.Second).Unix(),
+			State:   "exited",
+			Labels:  map[string]string{},
+		}
+		if len(daemon.images) > 0 {
+			image := daemon.images[i%len(daemon.images)]
+			container.ImageID, container.Image = image.ID, image.RepoTags[0]
+		}
+		if i%2 == 0 {
+			container.State = "running"
+		}
+		if i%5 == 0 {
+			container.Labels[composeProjectLabel] = fmt.Sprintf("project%d", i%20)
+		}
+		daemon.containers = append(daemon.containers, container)
+	}
+
+	for i := 0; i < size.Networks; i++ {
+		daemon.networks = append(daemon.networks, types.NetworkResource{Name: fmt.Sprintf("network_%d", i), ID: fakeID('n', i), Scope: "local", Driver: "bridge"})
+	}
+	for i := 0; i < size.Volumes; i++ {
+		daemon.volumes = append(daemon.volumes, &types.Volume{Name: fmt.Sprintf("volume_%d", i), Driver: "local"})
+	}
+
+	for i := 0; i < size.Nodes; i++ {
+		node := swarm.Node{ID: fakeID('h', i)}
+		node.Description.Hostname = fmt.Sprintf("node_%d", i)
+		node.Spec.Role, node.Spec.Availability, node.Status.State = "worker", "active", "ready"
+		if i == 0 {
+			node.Spec.Role, node.ManagerStatus = "manager", &swarm.ManagerStatus{Leader: true}
+		}
+		daemon.nodes = append(daemon.nodes, node)
+	}
+
+	// every third service is global, the others run two or three replicas of which odd services miss one
+	for i := 0; i < size.Services; i++ {
+		service := swarm.Service{ID: fakeID('s', i)}
+		service.Spec.Name = fmt.Sprintf("app_%d", i)
+		service.Spec.TaskTemplate.ContainerSpec = &swarm.ContainerSpec{Image: fmt.Sprintf("%s@sha256:%064x", repositories[i%len(repositories)], i)}
+		if i%4 != 3 {
+			service.Spec.Labels = map[string]string{stackNamespaceLabel: fmt.Sprintf("stack_%d", i%2)}
+		}
+
+		slots := []int{}
+		if i%3 == 2 {
+			service.Spec.Mode.Global = &swarm.GlobalService{}
+			for range daemon.nodes {
+				slots = append(slots, 0)
+			}
+		} else {
+			replicas := uint64(i%3 + 2)
+			service.Spec.Mode.Replicated = &swarm.ReplicatedService{Replicas: &replicas}
+			for slot := 1; slot <= int(replicas); slot++ {
+				slots = append(slots, slot)
+			}
+		}
+		daemon.services = append(daemon.services, service)
+
+		for j, slot := range slots {
+			task := swarm.Task{ID: fakeID('t', len(daemon.tasks)), ServiceID: service.ID, Slot: slot, DesiredState: swarm.TaskStateRunning}
+			task.Status.State = swarm.TaskStateRunning
+			if slot == 0 {
+				task.NodeID = daemon.nodes[j].ID
+			} else if i%2 == 1 && j == len(slots)-1 {
+				task.Status.State = "starting"
+			}
+			daemon.tasks = append(daemon.tasks, task)
+		}
+	}
+
+	for i, repository := range repositories[:6] {
+		daemon.hub = append(daemon.hub, hubRepository{RepoName: repository, ShortDescription: "Official image", StarCount: 1000 - i, IsOfficial: true})
+	}
+
+	return daemon
+}
+
+func (f *fakeDaemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := apiVersionPrefix.ReplaceAllString(r.URL.Path, "")
+
+	switch {
+	case path == "/_ping":
+		if f.apiVersion != "" {
+			w.Header().Set("API-Version", f.apiVersion)
+		}
+		w.Write([]byte("OK"))
+	case path == "/containers/json":
+		f.write(w, f.containers)
+	case path == "/images/json":
+		f.write(w, f.images)
+	case strings.HasPrefix(path, "/images/") && strings.HasSuffix(path, "/json"):
+		inspection, ok := f.inspections[strings.TrimSuffix(strings.TrimPrefix(path, "/images/"), "/json")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		f.write(w, inspection)
+	case path == "/networks":
+		f.write(w, f.networks)
+	case path == "/volumes":
+		f.write(w, volumetypes.VolumesListOKBody{Volumes: f.volumes})
+	case path == "/services":
+		f.write(w, f.services)
+	case path == "/tasks":
+		f.write(w, f.tasks)
+	case path == "/nodes":
+		f.write(w, f.nodes)
+	case path == "/events":
+		// the stream stays open without events until the client goes away
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	case path == "/v2/search/repositories/" || path == "/v2/repositories/library/":
+		results := []hubRepository{}
+		for _, repository := range f.hub {
+			if strings.Contains(repository.RepoName, r.URL.Query().Get("query")) {
+				results = append(results, repository)
+			}
+		}
+		f.write(w, DockerHubResult{Count: len(results), Items: results})
+	case strings.HasPrefix(path, "/v2/repositories/"):
+		f.write(w, hubRepository{LastUpdated: time.Now()})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeDaemon) write(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// useFakeDaemon points the shell at a fake daemon and a memory only cache, and syncs the object model.
+// The returned function restores the previous state.
+func useFakeDaemon(tb testing.TB, size fakeDaemonSize) func() {
+	server := httptest.NewServer(newFakeDaemon(size))
+	client, err := docker.NewClient("tcp://"+server.Listener.Addr().String(), "1.35", server.Client(), nil)
+	if err != nil {
+		server.Close()
+		tb.Fatal(err)
+	}
+
+	// the user's settings, catalog and docker config stay out of the tests
+	home, err := ioutil.TempDir("", "docker-shell-home")
+	if err != nil {
+		server.Close()
+		tb.Fatal(err)
+	}
+	previousEnv := map[string]*string{}
+	for _, name := range []string{"DOCKER_CONFIG", "XDG_CONFIG_HOME"} {
+		if value, ok := os.LookupEnv(name); ok {
+			previousEnv[name] = &value
+		} else {
+			previousEnv[name] = nil
+		}
+	}
+	os.Setenv("DOCKER_CONFIG", filepath.Join(home, "docker"))
+	os.Setenv("XDG_CONFIG_HOME", home)
+	previousSettings, previousCommands := settings, shellCommands
+	settings, shellCommands = defaultSettings(), commands.New()
+
+	model := &objectModel{client: client}
+	previous := swapConnection(daemonConnection{client: client, context: activeContext(), engine: activeEngine(), objects: model, stop: func() {}})
+	previousHub, previousCache := dockerHub, completionCache
+	dockerHub, completionCache = newHubClient(server.URL), newSuggestionCache("")
+	resetSources(client)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := model.resync(ctx); err != nil {
+		server.Close()
+		tb.Fatal(err)
+	}
+
+	return func() {
+		swapConnection(previous)
+		dockerHub, completionCache = previousHub, previousCache
+		resetSources(previous.client)
+		settings, shellCommands = previousSettings, previousCommands
+		for name, value := range previousEnv {
+			if value != nil {
+				os.Setenv(name, *value)
+			} else {
+				os.Unsetenv(name)
+			}
+		}
+		os.RemoveAll(home)
+		server.Close()
+	}
+}
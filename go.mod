@@ -22,4 +22,5 @@ require (
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/pkg/term v0.0.0-20190109203006-aa71e9d9e942 // indirect
 	golang.org/x/net v0.0.0-20200114155413-6afb5195e5aa // indirect
+	gopkg.in/yaml.v2 v2.4.0
 )
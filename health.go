@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// healthPingDeadline bounds a ping of the daemon
+const healthPingDeadline = 2 * time.Second
+
+var (
+	// healthInterval is how often a connected daemon is pinged
+	healthInterval = 5 * time.Second
+	// healthReconnectMin and healthReconnectMax bound the backoff between reconnection attempts
+	healthReconnectMin = time.Second
+	healthReconnectMax = 30 * time.Second
+)
+
+// daemonHealth is the state of the connection to the daemon as last seen by the health monitor
+type daemonHealth struct {
+	sync.Mutex
+	known     bool
+	connected bool
+}
+
+var health = &daemonHealth{}
+
+// record updates the state after a ping, err is nil when the daemon answered
+func (h *daemonHealth) record(err error) {
+	h.Lock()
+	defer h.Unlock()
+
+	h.known, h.connected = true, err == nil
+}
+
+func (h *daemonHealth) Connected() bool {
+	h.Lock()
+	defer h.Unlock()
+
+	return h.connected
+}
+
+// indicator is shown in the prompt while the daemon doesn't answer
+func (h *daemonHealth) indicator() string {
+	h.Lock()
+	defer h.Unlock()
+
+	if h.connected || !h.known {
+		return ""
+	}
+
+	return "[disconnected] "
+}
+
+// ping checks the daemon the shell is connected to
+func (h *daemonHealth) ping() error {
+	ctx, cancel := context.WithTimeout(context.Background(), healthPingDeadline)
+	defer cancel()
+
+	_, err := dockerClient().Ping(ctx)
+	return err
+}
+
+// monitor pings the daemon until ctx is done. A lost daemon is reconnected with an exponential backoff,
+// reconnecting starts completion over from fresh data.
+func (h *daemonHealth) monitor(ctx context.Context) {
+	backoff := healthReconnectMin
+	for {
+		wait := healthInterval
+		if !h.Connected() {
+			wait = backoff
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		if h.Connected() {
+			if err := h.ping(); err != nil {
+				h.record(err)
+				backoff = healthReconnectMin
+				completionEngine.refresh()
+			}
+			continue
+		}
+
+		if err := reconnectContext(); err != nil {
+			h.record(err)
+			if backoff *= 2; backoff > healthReconnectMax {
+				backoff = healthReconnectMax
+			}
+			continue
+		}
+		completionEngine.refresh()
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	docker "docker.io/go-docker"
+	commands "github.com/mstrYoda/docker-shell/lib"
+)
+
+// flakyDaemon answers like its fake daemon until it is taken down
+type flakyDaemon struct {
+	*fakeDaemon
+	down int32
+}
+
+func (f *flakyDaemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if atomic.LoadInt32(&f.down) == 1 {
+		http.Error(w, "daemon restarting", http.StatusServiceUnavailable)
+		return
+	}
+	f.fakeDaemon.ServeHTTP(w, r)
+}
+
+func waitFor(t *testing.T, what string, condition func() bool) {
+	for deadline := time.Now().Add(5 * time.Second); !condition(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+func TestHealthMonitorReconnects(t *testing.T) {
+	daemon := &flakyDaemon{fakeDaemon: newFakeDaemon(fakeDaemonSize{Containers: 3})}
+	server := httptest.NewServer(daemon)
+	defer server.Close()
+
+	previousEnv := map[string]*string{}
+	for _, name := range []string{"DOCKER_HOST", "DOCKER_CONTEXT"} {
+		if value, ok := os.LookupEnv(name); ok {
+			previousEnv[name] = &value
+		} else {
+			previousEnv[name] = nil
+		}
+	}
+	previous, previousInterval, previousBackoff := currentConnection(), healthInterval, healthReconnectMin
+	previousCommands := shellCommands
+	health.Lock()
+	previousKnown, previousConnected := health.known, health.connected
+	health.Unlock()
+	shellCommands = commands.New()
+	os.Setenv("DOCKER_HOST", "tcp://"+server.Listener.Addr().String())
+	os.Setenv("DOCKER_CONTEXT", defaultContextName)
+	healthInterval, healthReconnectMin = 20*time.Millisecond, 20*time.Millisecond
+
+	if err := connectContext(defaultContextName); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	monitored := make(chan struct{})
+	go func() {
+		health.monitor(ctx)
+		close(monitored)
+	}()
+	defer func() {
+		cancel()
+		<-monitored
+		for name, value := range previousEnv {
+			if value != nil {
+				os.Setenv(name, *value)
+			} else {
+				os.Unsetenv(name)
+			}
+		}
+		healthInterval, healthReconnectMin = previousInterval, previousBackoff
+		// the daemon of the test goes away, the shell is connected to the previous one again
+		current := swapConnection(previous)
+		current.stop()
+		resetSources(previous.client)
+		current.client.Close()
+		shellCommands = previousCommands
+		health.Lock()
+		health.known, health.connected = previousKnown, previousConnected
+		health.Unlock()
+	}()
+
+	atomic.StoreInt32(&daemon.down, 1)
+	waitFor(t, "the lost daemon", func() bool { return !health.Connected() })
+	if health.indicator() != "[disconnected] " {
+		t.Errorf("prompt indicator is %q while disconnected", health.indicator())
+	}
+
+	atomic.StoreInt32(&daemon.down, 0)
+	waitFor(t, "the reconnection", health.Connected)
+	if health.indicator() != "" {
+		t.Errorf("prompt indicator is %q after reconnecting", health.indicator())
+	}
+}
+
+// completion and the prompt keep reading the connection while it is replaced, go test -race checks the accesses
+func TestSwitchingClientsWhileCompleting(t *testing.T) {
+	defer useFakeDaemon(t, fakeDaemonSize{Containers: 3, Images: 3})()
+	server := httptest.NewServer(newFakeDaemon(fakeDaemonSize{Containers: 3, Images: 3}))
+	defer server.Close()
+	previous := currentConnection()
+
+	done := make(chan struct{})
+	completed := make(chan struct{})
+	go func() {
+		defer close(completed)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			for _, input := range completionInputs {
+				completer(documentOf(input.text, len(input.text)))
+			}
+			livePrefix()
+			promptPrefix()
+			dockerCLI("ps")
+		}
+	}()
+
+	for i := 0; i < 5; i++ {
+		client, err := docker.NewClient("tcp://"+server.Listener.Addr().String(), "1.35", server.Client(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		engine := engineDocker
+		if i%2 == 1 {
+			engine = enginePodman
+		}
+		useClient(client, defaultContextName, engine)
+		time.Sleep(20 * time.Millisecond)
+	}
+	close(done)
+	<-completed
+
+	current := swapConnection(previous)
+	current.stop()
+	resetSources(previous.client)
+	current.client.Close()
+}
+
+// a reconnection waiting while `context use` switches contexts follows the switch instead of undoing it
+func TestReconnectFollowsAContextSwitch(t *testing.T) {
+	defer useFakeDaemon(t, fakeDaemonSize{})()
+	dir, err := ioutil.TempDir("", "docker-shell-contexts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"first", "second"} {
+		server := httptest.NewServer(newFakeDaemon(fakeDaemonSize{}))
+		defer server.Close()
+		writeDockerContext(t, dir, name, "tcp://"+server.Listener.Addr().String())
+	}
+	os.Setenv("DOCKER_CONFIG", dir)
+
+	if err := connectContext("first"); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		current := currentConnection()
+		current.stop()
+		current.client.Close()
+	}()
+
+	// `context use second` holds the lock while the health monitor reconnects
+	connectLock.Lock()
+	reconnected := make(chan error)
+	go func() { reconnected <- reconnectContext() }()
+	time.Sleep(50 * time.Millisecond)
+	err = connectLocked("second")
+	connectLock.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := <-reconnected; err != nil {
+		t.Fatal(err)
+	}
+	if name := activeContext(); name != "second" {
+		t.Errorf("the reconnection switched the shell back to %q", name)
+	}
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/c-bata/go-prompt"
+	"github.com/hashicorp/go-retryablehttp"
+)
+
+// hubPageSize is the number of repositories fetched per Docker Hub page
+const hubPageSize = 25
+
+// hubRepository is a repository of a Docker Hub search or namespace listing.
+// Search results and namespace listings name the same fields differently.
+type hubRepository struct {
+	RepoName         string    `json:"repo_name,omitempty"`
+	Name             string    `json:"name,omitempty"`
+	Namespace        string    `json:"namespace,omitempty"`
+	ShortDescription string    `json:"short_description,omitempty"`
+	Description      string    `json:"description,omitempty"`
+	StarCount        int       `json:"star_count"`
+	PullCount        int64     `json:"pull_count"`
+	IsOfficial       bool      `json:"is_official"`
+	IsAutomated      bool      `json:"is_automated"`
+	LastUpdated      time.Time `json:"last_updated"`
+}
+
+// DockerHubResult : Wrap DockerHub API call
+type DockerHubResult struct {
+	Count int             `json:"count"`
+	Next  *string         `json:"next,omitempty"`
+	Items []hubRepository `json:"results,omitempty"`
+}
+
+// hubClient talks to the Docker Hub web API, authenticated with the credentials the docker CLI uses for Docker Hub
+type hubClient struct {
+	client  *retryablehttp.Client
+	baseURL string
+
+	login struct {
+		sync.Mutex
+		token   string
+		expires time.Time
+	}
+}
+
+// hubTokenLifetime is how long a Hub token without an expiry claim is used, and how long requests stay anonymous
+// before logging in again after a failed login
+const hubTokenLifetime = 5 * time.Minute
+
+// hubTokenMargin renews a token before it expires during a request
+const hubTokenMargin = 30 * time.Second
+
+func newHubClient(baseURL string) *hubClient {
+	client := retryablehttp.NewClient()
+	client.HTTPClient = &http.Client{
+		Timeout:   settings.HubTimeout,
+		Transport: settingsTransport,
+	}
+	client.RetryWaitMin = client.HTTPClient.Timeout
+	client.RetryWaitMax = client.HTTPClient.Timeout
+	client.RetryMax = settings.HubRetries
+	client.Logger = nil
+
+	return &hubClient{client: client, baseURL: strings.TrimSuffix(baseURL, "/")}
+}
+
+var dockerHub = newHubClient(settings.HubURL)
+
+// authenticate exchanges the Docker Hub credentials of config.json or its credential helper for an API token.
+// Identity tokens can't be used with the Hub API, requests stay anonymous then.
+func (h *hubClient) authenticate() string {
+	username, password := registryCredentials(loadDockerConfig(), "docker.io")
+	if username == "" || username == identityTokenUsername {
+		return ""
+	}
+
+	body, _ := json.Marshal(map[string]string{"username": username, "password": password})
+	response, err := h.client.Post(h.baseURL+"/v2/users/login/", "application/json", body)
+	if err != nil {
+		return ""
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return ""
+	}
+
+	login := struct {
+		Token string `json:"token"`
+	}{}
+	json.NewDecoder(response.Body).Decode(&login)
+	return login.Token
+}
+
+// token returns the Hub API token, logging in again once the previous token expired
+func (h *hubClient) token() string {
+	h.login.Lock()
+	defer h.login.Unlock()
+
+	if time.Now().Before(h.login.expires) {
+		return h.login.token
+	}
+
+	h.login.token = h.authenticate()
+	h.login.expires = time.Now().Add(hubTokenLifetime)
+	if expires, ok := tokenExpiry(h.login.token); ok {
+		h.login.expires = expires.Add(-hubTokenMargin)
+	}
+
+	return h.login.token
+}
+
+// expireToken drops token after the Hub refused it, unless it was replaced already
+func (h *hubClient) expireToken(token string) {
+	h.login.Lock()
+	defer h.login.Unlock()
+
+	if h.login.token == token {
+		h.login.expires = time.Time{}
+	}
+}
+
+// tokenExpiry reads the expiry claim of a JWT token, the Hub API tokens are JWTs
+func tokenExpiry(token string) (time.Time, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	claims := struct {
+		Expires int64 `json:"exp"`
+	}{}
+	if json.Unmarshal(payload, &claims) != nil || claims.Expires == 0 {
+		return time.Time{}, false
+	}
+
+	return time.Unix(claims.Expires, 0), true
+}
+
+func (h *hubClient) get(path string, query url.Values, v interface{}) error {
+	if hubRateLimit.backoff() {
+		return errHubBackoff
+	}
+
+	apiURL := h.baseURL + path
+	if len(query) > 0 {
+		apiURL += "?" + query.Encode()
+	}
+
+	token := h.token()
+	response, err := h.send(apiURL, token)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode == http.StatusUnauthorized && token != "" {
+		// the token was revoked or expired early, log in again once
+		response.Body.Close()
+		h.expireToken(token)
+		if response, err = h.send(apiURL, h.token()); err != nil {
+			return err
+		}
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", apiURL, response.Status)
+	}
+
+	return json.NewDecoder(response.Body).Decode(v)
+}
+
+func (h *hubClient) send(apiURL string, token string) (*http.Response, error) {
+	request, err := retryablehttp.NewRequest(http.MethodGet, apiURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	response, err := h.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	hubRateLimit.record(response)
+
+	return response, nil
+}
+
+// Search returns a page of repositories matching query across all namespaces.
+// Without a query it lists the official images.
+func (h *hubClient) Search(query string, page int, pageSize int) (*DockerHubResult, error) {
+	values := url.Values{
+		"page":      {strconv.Itoa(page)},
+		"page_size": {strconv.Itoa(pageSize)},
+	}
+
+	path := "/v2/repositories/library/"
+	if query != "" {
+		path = "/v2/search/repositories/"
+		values.Set("query", query)
+	} else {
+		values.Set("ordering", "-pull_count")
+	}
+
+	result := &DockerHubResult{}
+	if err := h.get(path, values, result); err != nil {
+		return nil, err
+	}
+
+	for i := range result.Items {
+		item := &result.Items[i]
+		if item.RepoName == "" {
+			item.RepoName = item.Name
+			if item.Namespace != "" && item.Namespace != "library" {
+				item.RepoName = item.Namespace + "/" + item.Name
+			}
+		}
+		if item.Namespace == "library" {
+			item.IsOfficial = true
+		}
+		if item.ShortDescription == "" {
+			item.ShortDescription = item.Description
+		}
+	}
+
+	return result, nil
+}
+
+// Repository returns the details of a single repository, e.g. "nginx" or "bitnami/redis"
+func (h *hubClient) Repository(name string) (hubRepository, error) {
+	if !strings.Contains(name, "/") {
+		name = "library/" + name
+	}
+
+	repository := hubRepository{}
+	err := h.get("/v2/repositories/"+name+"/", nil, &repository)
+	return repository, err
+}
+
+// hubRepositoryLookups bounds the repository lookups made at once for last update dates
+const hubRepositoryLookups = 4
+
+// hubLookups follows the repositories whose last update is looked up. Search results don't carry it, it is
+// fetched per repository a few at a time and cached for a day. A lookup waiting for its turn is dropped when
+// its repository isn't shown anymore, e.g. because the user kept typing.
+var hubLookups = struct {
+	sync.Mutex
+	shown map[string]bool
+	slots chan struct{}
+}{shown: map[string]bool{}, slots: make(chan struct{}, hubRepositoryLookups)}
+
+var errHubLookupDropped = errors.New("docker hub: repository isn't shown anymore")
+
+// showRepositories replaces the repositories whose last update is still wanted
+func showRepositories(names []string) {
+	hubLookups.Lock()
+	defer hubLookups.Unlock()
+
+	hubLookups.shown = map[string]bool{}
+	for _, name := range names {
+		hubLookups.shown[name] = true
+	}
+}
+
+// lastUpdated returns the cached last update of a repository, an unknown one is looked up in the background
+func (h *hubClient) lastUpdated(name string) time.Time {
+	updated := time.Time{}
+	completionCache.FetchAsync("hub-repository:"+name, 24*time.Hour, &updated, func() (interface{}, error) {
+		hubLookups.slots <- struct{}{}
+		defer func() { <-hubLookups.slots }()
+
+		hubLookups.Lock()
+		shown := hubLookups.shown[name]
+		hubLookups.Unlock()
+		if !shown {
+			return nil, errHubLookupDropped
+		}
+
+		repository, err := h.Repository(name)
+		if err != nil {
+			return nil, err
+		}
+		return repository.LastUpdated, nil
+	})
+
+	return updated
+}
+
+func (h *hubClient) suggestions(result *DockerHubResult) []prompt.Suggest {
+	suggestions := []prompt.Suggest{}
+	for _, s := range result.Items {
+		details := []string{"Remote community"}
+		if s.IsOfficial {
+			details[0] = "Remote official"
+		}
+		details = append(details, humanizeCount(int64(s.StarCount))+" stars", humanizeCount(s.PullCount)+" pulls")
+		updated := s.LastUpdated
+		if updated.IsZero() {
+			updated = h.lastUpdated(s.RepoName)
+		}
+		if !updated.IsZero() {
+			details = append(details, "updated "+updated.Format("2006-01-02"))
+		}
+		suggestions = append(suggestions, prompt.Suggest{Text: s.RepoName, Description: "(" + strings.Join(details, ", ") + ") " + s.ShortDescription})
+	}
+
+	return suggestions
+}
+
+func humanizeCount(count int64) string {
+	switch {
+	case count >= 1000000000:
+		return strconv.FormatFloat(float64(count)/1000000000, 'f', 1, 64) + "B"
+	case count >= 1000000:
+		return strconv.FormatFloat(float64(count)/1000000, 'f', 1, 64) + "M"
+	case count >= 1000:
+		return strconv.FormatFloat(float64(count)/1000, 'f', 1, 64) + "k"
+	default:
+		return strconv.FormatInt(count, 10)
+	}
+}
+
+// hubMoreMarker is appended to the query by the entry which loads the next page of results. Selecting the entry
+// puts it in the command line, the number of markers after the query is the number of extra pages shown.
+const hubMoreMarker = "…"
+
+// hubQuery splits a word typed for Hub completion into the query and the number of pages to show
+func hubQuery(word string) (string, int) {
+	query := strings.TrimRight(word, hubMoreMarker)
+	return query, 1 + strings.Count(word[len(query):], hubMoreMarker)
+}
+
+// hubPage returns a page of Hub search results. Completers don't wait for a page which isn't cached yet.
+func hubPage(query string, page int, count int, wait bool) (*DockerHubResult, bool) {
+	result := &DockerHubResult{}
+	fetch := completionCache.FetchAsync
+	if wait {
+		fetch = completionCache.Fetch
+	}
+	found := fetch(fmt.Sprintf("hub:%s:%d:%d", query, count, page), 5*time.Minute, result, func() (interface{}, error) {
+		return dockerHub.Search(query, page, count)
+	})
+
+	return result, found
+}
+
+// hubSuggestions returns the first pages of query, followed by an entry loading one more page when there is one
+func hubSuggestions(query string, pages int, count int) []prompt.Suggest {
+	results := []*DockerHubResult{}
+	names := []string{}
+	hasNext := false
+	for page := 1; page <= pages; page++ {
+		result, ok := hubPage(query, page, count, false)
+		if !ok {
+			break
+		}
+		results = append(results, result)
+		for _, item := range result.Items {
+			names = append(names, item.RepoName)
+		}
+		hasNext = result.Next != nil && *result.Next != ""
+	}
+	showRepositories(names)
+
+	suggestions := []prompt.Suggest{}
+	for _, result := range results {
+		suggestions = append(suggestions, dockerHub.suggestions(result)...)
+	}
+	if hasNext && len(results) == pages {
+		suggestions = append(suggestions, prompt.Suggest{
+			Text:        query + strings.Repeat(hubMoreMarker, pages),
+			Description: fmt.Sprintf("More results: select to load page %d", pages+1),
+		})
+	}
+
+	return suggestions
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeHubToken returns a JWT shaped token expiring at expires, a zero expires leaves the claim out
+func fakeHubToken(id int, expires time.Time) string {
+	claims := map[string]interface{}{"jti": id}
+	if !expires.IsZero() {
+		claims["exp"] = expires.Unix()
+	}
+	payload, _ := json.Marshal(claims)
+	return "e30." + base64.RawURLEncoding.EncodeToString(payload) + ".c2lnbmF0dXJl"
+}
+
+// fakeHubLogin hands out tokens with the given expiries and accepts only the latest one
+type fakeHubLogin struct {
+	sync.Mutex
+	expiries []time.Time
+	logins   int
+	valid    string
+}
+
+func (f *fakeHubLogin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+
+	if r.URL.Path == "/v2/users/login/" {
+		expires := f.expiries[len(f.expiries)-1]
+		if f.logins < len(f.expiries) {
+			expires = f.expiries[f.logins]
+		}
+		f.logins++
+		f.valid = fakeHubToken(f.logins, expires)
+		json.NewEncoder(w).Encode(map[string]string{"token": f.valid})
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer "+f.valid {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	json.NewEncoder(w).Encode(hubRepository{RepoName: "nginx"})
+}
+
+// revoke makes the Hub refuse the current token
+func (f *fakeHubLogin) revoke() {
+	f.Lock()
+	defer f.Unlock()
+	f.valid = ""
+}
+
+func useHubCredentials(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "docker-shell-hub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, _ := json.Marshal(dockerConfigFile{Auths: map[string]dockerAuthConfig{dockerHubServerURL: {Username: "alice", Password: "s3cret"}}})
+	if err := ioutil.WriteFile(filepath.Join(dir, "config.json"), config, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	previous, ok := os.LookupEnv("DOCKER_CONFIG")
+	os.Setenv("DOCKER_CONFIG", dir)
+	return func() {
+		if ok {
+			os.Setenv("DOCKER_CONFIG", previous)
+		} else {
+			os.Unsetenv("DOCKER_CONFIG")
+		}
+		os.RemoveAll(dir)
+	}
+}
+
+func TestHubTokenRenewal(t *testing.T) {
+	defer useHubCredentials(t)()
+
+	for _, test := range []struct {
+		name     string
+		expiries []time.Time
+		revoke   bool
+		logins   int
+	}{
+		{"valid token is reused", []time.Time{time.Now().Add(time.Hour)}, false, 1},
+		{"expired token is renewed", []time.Time{time.Now().Add(hubTokenMargin / 2), time.Now().Add(time.Hour)}, false, 2},
+		{"token without expiry is reused", []time.Time{{}}, false, 1},
+		{"revoked token is renewed", []time.Time{time.Now().Add(time.Hour)}, true, 2},
+	} {
+		hub := &fakeHubLogin{expiries: test.expiries}
+		server := httptest.NewServer(hub)
+		client := newHubClient(server.URL)
+
+		for i := 0; i < 2; i++ {
+			if _, err := client.Repository("nginx"); err != nil {
+				t.Errorf("%s: request %d: %v", test.name, i, err)
+			}
+			if test.revoke {
+				hub.revoke()
+			}
+		}
+		server.Close()
+
+		if hub.logins != test.logins {
+			t.Errorf("%s: logged in %d times, want %d", test.name, hub.logins, test.logins)
+		}
+	}
+}
+
+func TestTokenExpiry(t *testing.T) {
+	expires := time.Unix(1700000000, 0)
+	for _, test := range []struct {
+		token string
+		ok    bool
+	}{
+		{fakeHubToken(1, expires), true},
+		{fakeHubToken(1, time.Time{}), false},
+		{"opaque-token", false},
+		{"a.!!!.c", false},
+		{fmt.Sprintf("a.%s.c", base64.RawURLEncoding.EncodeToString([]byte("not json"))), false},
+	} {
+		got, ok := tokenExpiry(test.token)
+		if ok != test.ok || (ok && !got.Equal(expires)) {
+			t.Errorf("%q: got %s/%t", test.token, got, ok)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/c-bata/go-prompt"
+)
+
+// imagesSuggestion lists the local images by repository and tag, untagged ones by short id
+func imagesSuggestion() ([]prompt.Suggest, error) {
+	suggestions := []prompt.Suggest{}
+
+	images, err := imageList()
+	for _, image := range images {
+		created := time.Unix(image.Created, 0).Format("2006-01-02")
+		tagged := false
+		for _, repoTag := range image.RepoTags {
+			if repoTag == "<none>:<none>" {
+				continue
+			}
+			tagged = true
+			tag := repoTag[strings.LastIndex(repoTag, ":")+1:]
+			suggestions = append(suggestions, prompt.Suggest{
+				Text:        repoTag,
+				Description: "(Local, " + tag + ", " + humanizeSize(image.Size) + ") created " + created,
+			})
+		}
+
+		if !tagged {
+			suggestions = append(suggestions, prompt.Suggest{
+				Text:        shortImageID(image.ID),
+				Description: "(Local, untagged, " + humanizeSize(image.Size) + ") created " + created,
+			})
+		}
+	}
+
+	return suggestions, err
+}
+
+// shortImageID is the 12 character id docker prints for an image
+func shortImageID(id string) string {
+	id = strings.TrimPrefix(id, "sha256:")
+	if len(id) > 12 {
+		return id[:12]
+	}
+
+	return id
+}
+
+// localRepository normalizes a local or remote image name to compare them: docker.io and library/ are dropped
+func localRepository(name string) string {
+	if index := strings.LastIndex(name, ":"); index != -1 && !strings.Contains(name[index:], "/") {
+		name = name[:index]
+	}
+	name = strings.TrimPrefix(name, "docker.io/")
+
+	return strings.TrimPrefix(name, "library/")
+}
+
+// imageBoolFlags are the flags of commands taking an image which don't consume the next argument,
+// every other flag does unless its value is given with `=`
+var imageBoolFlags = map[string]map[string]bool{
+	"run": {
+		"-d": true, "--detach": true, "-i": true, "--interactive": true, "-t": true, "--tty": true,
+		"-P": true, "--publish-all": true, "-q": true, "--quiet": true, "--rm": true, "--init": true,
+		"--privileged": true, "--read-only": true, "--no-healthcheck": true, "--oom-kill-disable": true,
+		"--sig-proxy": true, "--disable-content-trust": true, "--help": true,
+	},
+	"pull": {"-a": true, "--all-tags": true, "-q": true, "--quiet": true, "--disable-content-trust": true, "--help": true},
+}
+
+// isImageBoolFlag tells whether a flag of command doesn't consume the next argument, combined short flags
+// like `-it` are split
+func isImageBoolFlag(command string, flag string) bool {
+	if spec, ok := shellCommands.GetFlagSpec(command, flag); ok {
+		return spec.Type == "bool"
+	}
+	if imageBoolFlags[command][flag] {
+		return true
+	}
+	if strings.HasPrefix(flag, "--") || len(flag) < 3 {
+		return false
+	}
+	for _, short := range flag[1:] {
+		if !imageBoolFlags[command]["-"+string(short)] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// imageArgument finds the image among the arguments following command: the first positional, skipping flags
+// and their values. It returns -1 when the image hasn't been typed yet, pending is set when the arguments
+// end with a flag waiting for its value.
+func imageArgument(command string, args []string) (index int, pending bool) {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			continue
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			return i, false
+		}
+		if strings.Contains(arg, "=") || isImageBoolFlag(command, arg) {
+			continue
+		}
+		if i+1 >= len(args) {
+			return -1, true
+		}
+		i++
+	}
+
+	return -1, false
+}
+
+// commandArguments returns the fields of text which follow the last word of command
+func commandArguments(command string, text string) []string {
+	fields := strings.Fields(text)
+	name := command[strings.LastIndex(command, " ")+1:]
+	for i, field := range fields {
+		if field == name {
+			return fields[i+1:]
+		}
+	}
+
+	return []string{}
+}
+
+// completesImage tells whether the word before the cursor is the image argument of command
+func completesImage(command string, d prompt.Document) bool {
+	index, pending := imageArgument(command, commandArguments(command, strings.TrimSuffix(d.TextBeforeCursor(), d.GetWordBeforeCursor())))
+	return index == -1 && !pending
+}
+
+// mergeHubSuggestions appends the Hub repositories to suggestions, a repository which is present locally
+// isn't listed twice: its Hub details are added to the descriptions of the local images
+func mergeHubSuggestions(suggestions []prompt.Suggest, hub []prompt.Suggest) []prompt.Suggest {
+	local := map[string][]int{}
+	for i, s := range suggestions {
+		if strings.HasPrefix(s.Description, "(Local") {
+			repository := localRepository(s.Text)
+			local[repository] = append(local[repository], i)
+		}
+	}
+
+	for _, s := range hub {
+		indexes, ok := local[localRepository(s.Text)]
+		if !ok {
+			suggestions = append(suggestions, s)
+			continue
+		}
+		for _, i := range indexes {
+			suggestions[i].Description += " · Hub " + s.Description
+		}
+	}
+
+	return suggestions
+}
+
+// imageSuggestion merges the local images, the private registries and Docker Hub into one list.
+// Local images come first, Hub repositories which are present locally are merged into their local entries.
+func imageSuggestion(d prompt.Document, word string, remote bool) []prompt.Suggest {
+	typed := word
+	word, _ = hubQuery(word)
+	local := prompt.FilterHasPrefix(guardSource("images", d, imagesSuggestion), word, true)
+
+	if strings.Index(word, "@") != -1 {
+		return pinSuggestion(word)
+	}
+	if isRegistryReference(word) {
+		return append(local, registrySuggestion(word)...)
+	}
+
+	seen := map[string]bool{}
+	for _, s := range local {
+		seen[s.Text] = true
+	}
+
+	if strings.Index(word, ":") != -1 {
+		suggestions := local
+		for _, s := range tagSuggestion(word) {
+			if !seen[s.Text] {
+				suggestions = append(suggestions, s)
+			}
+		}
+		return suggestions
+	}
+
+	suggestions := append(local, registrySuggestion(word)...)
+	if !remote || (word != "" && len(word) <= 2) {
+		return suggestions
+	}
+
+	return mergeHubSuggestions(suggestions, imageFetchCompleter(typed, hubPageSize))
+}
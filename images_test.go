@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/c-bata/go-prompt"
+)
+
+func TestImageArgument(t *testing.T) {
+	for _, test := range []struct {
+		command string
+		line    string
+		index   int
+		pending bool
+	}{
+		{"run", "", -1, false},
+		{"run", "alpine echo hello", 0, false},
+		{"run", "--rm -it alpine sh", 2, false},
+		{"run", "-e A=1 -v /data:/data --name web nginx", 6, false},
+		{"run", "--network=host -p 80:80 nginx", 3, false},
+		{"run", "--entrypoint", -1, true},
+		{"run", "-d --restart always", -1, false},
+		{"run", "-dit --", -1, false},
+		{"run", "-w", -1, true},
+		{"pull", "-a --platform linux/arm64 alpine", 3, false},
+		{"pull", "-q", -1, false},
+	} {
+		index, pending := imageArgument(test.command, strings.Fields(test.line))
+		if index != test.index || pending != test.pending {
+			t.Errorf("%s %q: got %d, %v, want %d, %v", test.command, test.line, index, pending, test.index, test.pending)
+		}
+	}
+}
+
+func TestMergeHubSuggestions(t *testing.T) {
+	local := []prompt.Suggest{
+		{Text: "nginx:1.25", Description: "(Local, 1.25, 187.0MB) created 2024-01-02"},
+		{Text: "nginx:latest", Description: "(Local, latest, 187.0MB) created 2024-01-02"},
+		{Text: "registry.example.com/nginx", Description: "Private registry"},
+	}
+	hub := []prompt.Suggest{
+		{Text: "nginx", Description: "(Remote official, 19k stars) Official build of Nginx."},
+		{Text: "nginxinc/nginx-unprivileged", Description: "(Remote community, 100 stars) Unprivileged NGINX"},
+	}
+
+	got := mergeHubSuggestions(local, hub)
+	if len(got) != 4 || got[3].Text != "nginxinc/nginx-unprivileged" {
+		t.Fatalf("merged suggestions are %+v", got)
+	}
+	for _, s := range got[:2] {
+		if !strings.HasSuffix(s.Description, " · Hub (Remote official, 19k stars) Official build of Nginx.") {
+			t.Errorf("%s isn't merged with its Hub repository: %q", s.Text, s.Description)
+		}
+	}
+	if got[2].Description != "Private registry" {
+		t.Errorf("a registry entry got Hub details: %q", got[2].Description)
+	}
+}
+
+func TestRunSearchesTheHubOnlyForTheImage(t *testing.T) {
+	defer useFakeDaemon(t, fakeDaemonSize{})()
+	searches := int32(0)
+	host, restore := useFakeRegistry(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&searches, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"count": 0, "results": []}`))
+	}))
+	defer restore()
+	previousHub := dockerHub
+	dockerHub = newHubClient("http://" + host)
+	defer func() { dockerHub = previousHub }()
+
+	for _, line := range []string{"run alpine echo hel", "run --name web", "run -e A=1 --workdir /app alpine sh", "pull alpine lat"} {
+		completeCommand(documentOf(line, len(line)))
+	}
+	if n := atomic.LoadInt32(&searches); n != 0 {
+		t.Fatalf("%d Hub searches for arguments which aren't the image", n)
+	}
+
+	line := "run --rm -it -e A=1 ngin"
+	completeCommand(documentOf(line, len(line)))
+	waitFor(t, "a Hub search for the image", func() bool { return atomic.LoadInt32(&searches) > 0 })
+}
@@ -0,0 +1,153 @@
+package commands
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/c-bata/go-prompt"
+)
+
+// CompareAPIVersions compares two daemon API versions like "1.41", missing parts count as 0
+func CompareAPIVersions(a string, b string) int {
+	partsA, partsB := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(partsA) || i < len(partsB); i++ {
+		numberA, numberB := 0, 0
+		if i < len(partsA) {
+			numberA, _ = strconv.Atoi(partsA[i])
+		}
+		if i < len(partsB) {
+			numberB, _ = strconv.Atoi(partsB[i])
+		}
+		if numberA != numberB {
+			if numberA < numberB {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	return 0
+}
+
+func validAPIVersion(version string) bool {
+	parts := strings.Split(version, ".")
+	if len(parts) != 2 {
+		return false
+	}
+	for _, part := range parts {
+		if _, err := strconv.Atoi(part); err != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// SetAPIVersion hides the commands and flags the daemon API doesn't support, "" shows everything
+func (c *Commands) SetAPIVersion(version string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.apiVersion = version
+}
+
+// APIVersion returns the API version the catalog is filtered for
+func (c *Commands) APIVersion() string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.apiVersion
+}
+
+// SetEngine hides the commands a Docker compatible engine like podman doesn't implement
+func (c *Commands) SetEngine(engine string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.engine = engine
+}
+
+// Supported tells whether the API version and the engine support a command or a "command flag" pair
+func (c *Commands) Supported(name string) bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.supported(name)
+}
+
+func (c *Commands) supported(name string) bool {
+	if contains(c.EngineUnsupported[c.engine], name) {
+		return false
+	}
+	required, ok := c.MinAPIVersions[name]
+	return !ok || c.apiVersion == "" || CompareAPIVersions(c.apiVersion, required) >= 0
+}
+
+func (c *Commands) supportedSuggestions(parent string, suggestions []prompt.Suggest) []prompt.Suggest {
+	if c.apiVersion == "" && len(c.EngineUnsupported[c.engine]) == 0 {
+		return suggestions
+	}
+
+	supported := make([]prompt.Suggest, 0, len(suggestions))
+	for _, s := range suggestions {
+		name := s.Text
+		if parent != "" {
+			name = parent + " " + s.Text
+		}
+		if c.supported(name) {
+			supported = append(supported, s)
+		}
+	}
+
+	return supported
+}
+
+// required returns the API version a command or flag needs, "" when the engine doesn't implement it at all
+func (c *Commands) required(name string) string {
+	if contains(c.EngineUnsupported[c.engine], name) {
+		return ""
+	}
+
+	return c.MinAPIVersions[name]
+}
+
+// Unsupported returns the first command or flag of a command line which needs a newer API, with the version it needs.
+// Commands the engine doesn't implement come without a version.
+func (c *Commands) Unsupported(args []string) (string, string, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	command, ok := c.findCommand(strings.Join(args, " "))
+	if !ok {
+		return "", "", false
+	}
+	parts := strings.Fields(command)
+	// leaf subcommands like `network prune` have no suggestions of their own
+	if len(args) > len(parts) && !strings.HasPrefix(args[len(parts)], "-") {
+		for _, s := range c.DockerSubSuggestions[command] {
+			if s.Text == args[len(parts)] {
+				command += " " + s.Text
+				parts = append(parts, s.Text)
+				break
+			}
+		}
+	}
+
+	for i := 1; i <= len(parts); i++ {
+		name := strings.Join(parts[:i], " ")
+		if !c.supported(name) {
+			return name, c.required(name), true
+		}
+	}
+	for _, arg := range args[len(parts):] {
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		name := command + " " + strings.SplitN(arg, "=", 2)[0]
+		if !c.supported(name) {
+			return name, c.required(name), true
+		}
+	}
+
+	return "", "", false
+}
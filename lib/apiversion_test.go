@@ -0,0 +1,96 @@
+package commands
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCompareAPIVersions(t *testing.T) {
+	for _, test := range []struct {
+		a, b string
+		want int
+	}{
+		{"1.41", "1.41", 0},
+		{"1.9", "1.10", -1},
+		{"1.10", "1.9", 1},
+		{"1.25", "1.32", -1},
+		{"2.0", "1.43", 1},
+		{"1.40", "1.40.0", 0},
+	} {
+		if got := CompareAPIVersions(test.a, test.b); got != test.want {
+			t.Errorf("CompareAPIVersions(%q, %q) = %d, want %d", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestValidAPIVersion(t *testing.T) {
+	for version, want := range map[string]bool{
+		"1.41":   true,
+		"1.9":    true,
+		"1":      false,
+		"1.41.0": false,
+		"v1.41":  false,
+		"1.x":    false,
+		"":       false,
+		"latest": false,
+	} {
+		if got := validAPIVersion(version); got != want {
+			t.Errorf("validAPIVersion(%q) = %v, want %v", version, got, want)
+		}
+	}
+}
+
+func TestUnsupported(t *testing.T) {
+	for _, test := range []struct {
+		apiVersion string
+		engine     string
+		line       string
+		name       string
+		required   string
+	}{
+		{"1.41", "docker", "run --platform linux/arm64 alpine", "", ""},
+		{"1.30", "docker", "run --platform linux/arm64 alpine", "run --platform", "1.32"},
+		{"1.30", "docker", "run --platform=linux/arm64 alpine", "run --platform", "1.32"},
+		{"1.30", "docker", "run --rm alpine", "", ""},
+		{"1.24", "docker", "system df", "system", "1.25"},
+		{"1.28", "docker", "service logs web", "service logs", "1.29"},
+		{"1.9", "docker", "network prune", "network prune", "1.25"},
+		{"", "docker", "run --gpus all alpine", "", ""},
+		{"1.41", "podman", "swarm init", "swarm", ""},
+		{"1.41", "podman", "run --rm alpine", "", ""},
+		{"1.41", "docker", "unknown-command", "", ""},
+	} {
+		c := New()
+		c.SetAPIVersion(test.apiVersion)
+		c.SetEngine(test.engine)
+
+		name, required, ok := c.Unsupported(strings.Fields(test.line))
+		if ok != (test.name != "") || name != test.name || required != test.required {
+			t.Errorf("%s with API %q on %s: got %q, %q, %v, want %q, %q", test.line, test.apiVersion, test.engine, name, required, ok, test.name, test.required)
+		}
+	}
+}
+
+// the version is set by the health monitor while completion reads the catalog, go test -race checks it
+func TestSetAPIVersionWhileReading(t *testing.T) {
+	c := New()
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			c.SetAPIVersion("1.2" + string(rune('0'+i%10)))
+			c.SetEngine("podman")
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			c.GetDockerSuggestions()
+			c.Unsupported([]string{"run", "--platform", "linux/arm64"})
+			c.APIVersion()
+		}
+	}()
+	wg.Wait()
+}
@@ -0,0 +1,322 @@
+package commands
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/c-bata/go-prompt"
+	"gopkg.in/yaml.v2"
+)
+
+// ValueTypes lists the flag value types a catalog file may declare
+var ValueTypes = []string{"bool", "string", "int", "duration", "bytes", "enum", "list"}
+
+// CompleterNames lists the completers a catalog file may refer to by name
+var CompleterNames = []string{
+	"containers", "running-containers", "images", "ports", "hub-images",
+	"services", "services-and-tasks", "service-scales", "nodes", "stacks", "networks", "volumes", "contexts",
+}
+
+// FlagSpec describes the value a flag takes
+type FlagSpec struct {
+	Type      string
+	Choices   []string
+	Default   string
+	Completer string
+}
+
+// CatalogFile is the schema of a user catalog file in YAML or JSON
+type CatalogFile struct {
+	Commands []CatalogCommand `yaml:"commands"`
+}
+
+// CatalogCommand adds a command or overrides an existing one. Subcommands are named with spaces, e.g. "service scale"
+type CatalogCommand struct {
+	Name        string   `yaml:"name"`
+	Description string   `yaml:"description"`
+	Usage       string   `yaml:"usage"`
+	Examples    []string `yaml:"examples"`
+	Completer   string   `yaml:"completer"`
+	// MinAPIVersion hides the command while the daemon speaks an older API, e.g. "1.41"
+	MinAPIVersion string        `yaml:"min_api_version"`
+	Flags         []CatalogFlag `yaml:"flags"`
+}
+
+// CatalogFlag adds a flag to a command or overrides an existing one
+type CatalogFlag struct {
+	Name        string   `yaml:"name"`
+	Description string   `yaml:"description"`
+	Type        string   `yaml:"type"`
+	Choices     []string `yaml:"choices"`
+	Default     string   `yaml:"default"`
+	Completer   string   `yaml:"completer"`
+	// MinAPIVersion hides the flag while the daemon speaks an older API
+	MinAPIVersion string `yaml:"min_api_version"`
+}
+
+// UserConfigDir returns the XDG configuration directory of the shell
+func UserConfigDir() string {
+	base := os.Getenv("XDG_CONFIG_HOME")
+	if base == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		base = filepath.Join(home, ".config")
+	}
+
+	return filepath.Join(base, "docker-shell")
+}
+
+// UserCatalogDir returns the directory user catalog files are read from
+func UserCatalogDir() string {
+	dir := UserConfigDir()
+	if dir == "" {
+		return ""
+	}
+
+	return filepath.Join(dir, "commands.d")
+}
+
+// LoadUserCatalog merges the user's catalog files from UserCatalogDir into the catalog
+func (c *Commands) LoadUserCatalog() []error {
+	dir := UserCatalogDir()
+	if dir == "" {
+		return nil
+	}
+
+	return c.LoadDir(dir)
+}
+
+// LoadDir merges every .yaml, .yml and .json file of dir in lexical order into the catalog.
+// Files which fail to parse or validate are skipped and reported.
+func (c *Commands) LoadDir(dir string) []error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return []error{err}
+	}
+
+	names := []string{}
+	for _, entry := range entries {
+		switch strings.ToLower(filepath.Ext(entry.Name())) {
+		case ".yaml", ".yml", ".json":
+			if !entry.IsDir() {
+				names = append(names, entry.Name())
+			}
+		}
+	}
+	sort.Strings(names)
+
+	errs := []error{}
+	for _, name := range names {
+		if err := c.LoadFile(filepath.Join(dir, name)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs
+}
+
+// LoadFile validates a single catalog file and merges it into the catalog
+func (c *Commands) LoadFile(path string) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	file := CatalogFile{}
+	if err := yaml.UnmarshalStrict(content, &file); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+
+	if err := file.Validate(); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, command := range file.Commands {
+		c.merge(command)
+	}
+
+	return nil
+}
+
+// Validate checks the file against the catalog schema
+func (f *CatalogFile) Validate() error {
+	for i, command := range f.Commands {
+		name := strings.Join(strings.Fields(command.Name), " ")
+		if name == "" {
+			return fmt.Errorf("commands[%d]: name is required", i)
+		}
+		if strings.HasPrefix(name, "-") {
+			return fmt.Errorf("commands[%d] %q: command names can not start with '-'", i, name)
+		}
+		if command.Completer != "" && !contains(CompleterNames, command.Completer) {
+			return fmt.Errorf("commands[%d] %q: unknown completer %q (known: %s)", i, name, command.Completer, strings.Join(CompleterNames, ", "))
+		}
+		if command.MinAPIVersion != "" && !validAPIVersion(command.MinAPIVersion) {
+			return fmt.Errorf("commands[%d] %q: %q is not an API version like 1.41", i, name, command.MinAPIVersion)
+		}
+
+		for j, flag := range command.Flags {
+			if !strings.HasPrefix(flag.Name, "-") || strings.ContainsAny(flag.Name, " \t") {
+				return fmt.Errorf("commands[%d] %q: flags[%d]: %q is not a valid flag name", i, name, j, flag.Name)
+			}
+			if flag.Type != "" && !contains(ValueTypes, flag.Type) {
+				return fmt.Errorf("commands[%d] %q: flag %s: unknown type %q (known: %s)", i, name, flag.Name, flag.Type, strings.Join(ValueTypes, ", "))
+			}
+			if flag.Type == "enum" && len(flag.Choices) == 0 {
+				return fmt.Errorf("commands[%d] %q: flag %s: enum type requires choices", i, name, flag.Name)
+			}
+			if flag.Type != "enum" && flag.Type != "" && len(flag.Choices) > 0 {
+				return fmt.Errorf("commands[%d] %q: flag %s: choices are only allowed for enum type", i, name, flag.Name)
+			}
+			if flag.Type == "enum" && flag.Default != "" && !contains(flag.Choices, flag.Default) {
+				return fmt.Errorf("commands[%d] %q: flag %s: default %q is not one of the choices", i, name, flag.Name, flag.Default)
+			}
+			if flag.Completer != "" && !contains(CompleterNames, flag.Completer) {
+				return fmt.Errorf("commands[%d] %q: flag %s: unknown completer %q (known: %s)", i, name, flag.Name, flag.Completer, strings.Join(CompleterNames, ", "))
+			}
+			if flag.MinAPIVersion != "" && !validAPIVersion(flag.MinAPIVersion) {
+				return fmt.Errorf("commands[%d] %q: flag %s: %q is not an API version like 1.41", i, name, flag.Name, flag.MinAPIVersion)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c *Commands) merge(command CatalogCommand) {
+	name := strings.Join(strings.Fields(command.Name), " ")
+	parts := strings.Split(name, " ")
+	parent, leaf := strings.Join(parts[:len(parts)-1], " "), parts[len(parts)-1]
+
+	if parent == "" {
+		c.DockerSuggestions = upsertSuggest(c.DockerSuggestions, leaf, command.Description)
+	} else {
+		c.DockerSubSuggestions[parent] = upsertSuggest(c.DockerSubSuggestions[parent], leaf, command.Description)
+	}
+
+	if command.Completer != "" {
+		c.ArgCompleters[name] = command.Completer
+	}
+	if command.Usage != "" {
+		c.Usages[name] = command.Usage
+	}
+	if len(command.Examples) > 0 {
+		c.Examples[name] = append(c.Examples[name], command.Examples...)
+	}
+	if command.MinAPIVersion != "" {
+		c.MinAPIVersions[name] = command.MinAPIVersion
+	}
+
+	if len(command.Flags) > 0 {
+		if _, ok := c.DockerSubSuggestions[name]; !ok {
+			c.DockerSubSuggestions[name] = []prompt.Suggest{}
+		}
+		if _, ok := c.FlagSpecs[name]; !ok {
+			c.FlagSpecs[name] = map[string]FlagSpec{}
+		}
+	}
+
+	for _, flag := range command.Flags {
+		c.DockerSubSuggestions[name] = upsertSuggest(c.DockerSubSuggestions[name], flag.Name, flag.Description)
+
+		spec := c.FlagSpecs[name][flag.Name]
+		if flag.Type != "" {
+			spec.Type = flag.Type
+		}
+		if len(flag.Choices) > 0 {
+			spec.Choices = flag.Choices
+		}
+		if flag.Default != "" {
+			spec.Default = flag.Default
+		}
+		if flag.Completer != "" {
+			spec.Completer = flag.Completer
+		}
+		c.FlagSpecs[name][flag.Name] = spec
+		if flag.MinAPIVersion != "" {
+			c.MinAPIVersions[name+" "+flag.Name] = flag.MinAPIVersion
+		}
+	}
+}
+
+// GetFlagSpec returns the value description of a command flag
+func (c *Commands) GetFlagSpec(command string, flag string) (FlagSpec, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	spec, ok := c.FlagSpecs[command][flag]
+	return spec, ok
+}
+
+// GetArgCompleter returns the completer name for the positional arguments of a command
+func (c *Commands) GetArgCompleter(command string) (string, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	name, ok := c.ArgCompleters[command]
+	return name, ok
+}
+
+// FindCommand returns the longest catalog command the given text starts with
+func (c *Commands) FindCommand(text string) (string, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.findCommand(text)
+}
+
+func (c *Commands) findCommand(text string) (string, bool) {
+	fields := strings.Fields(text)
+	found := ""
+	for i := 1; i <= len(fields); i++ {
+		candidate := strings.Join(fields[:i], " ")
+		if _, ok := c.DockerSubSuggestions[candidate]; ok {
+			found = candidate
+			continue
+		}
+		if i == 1 && c.isDockerCommand(candidate) {
+			found = candidate
+			continue
+		}
+		break
+	}
+
+	return found, found != ""
+}
+
+// upsertSuggest never changes suggestions in place, readers may still hold the slice
+func upsertSuggest(suggestions []prompt.Suggest, text string, description string) []prompt.Suggest {
+	for i := range suggestions {
+		if suggestions[i].Text == text {
+			if description == "" {
+				return suggestions
+			}
+			updated := append([]prompt.Suggest{}, suggestions...)
+			updated[i].Description = description
+			return updated
+		}
+	}
+
+	return append(suggestions, prompt.Suggest{Text: text, Description: description})
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,122 @@
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCatalogFileValidate(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		command CatalogCommand
+		err     string
+	}{
+		{"valid", CatalogCommand{Name: "deploy", Completer: "contexts", Flags: []CatalogFlag{{Name: "--env", Type: "enum", Choices: []string{"dev", "prod"}, Default: "dev"}}}, ""},
+		{"missing name", CatalogCommand{Name: " "}, "name is required"},
+		{"flag as command", CatalogCommand{Name: "--deploy"}, "can not start with '-'"},
+		{"bad completer", CatalogCommand{Name: "deploy", Completer: "clusters"}, `unknown completer "clusters"`},
+		{"bad api version", CatalogCommand{Name: "deploy", MinAPIVersion: "latest"}, `"latest" is not an API version`},
+		{"flag without dash", CatalogCommand{Name: "deploy", Flags: []CatalogFlag{{Name: "env"}}}, `"env" is not a valid flag name`},
+		{"flag with space", CatalogCommand{Name: "deploy", Flags: []CatalogFlag{{Name: "--env name"}}}, "is not a valid flag name"},
+		{"bad flag type", CatalogCommand{Name: "deploy", Flags: []CatalogFlag{{Name: "--env", Type: "text"}}}, `unknown type "text"`},
+		{"enum without choices", CatalogCommand{Name: "deploy", Flags: []CatalogFlag{{Name: "--env", Type: "enum"}}}, "requires choices"},
+		{"choices without enum", CatalogCommand{Name: "deploy", Flags: []CatalogFlag{{Name: "--env", Type: "string", Choices: []string{"dev"}}}}, "only allowed for enum"},
+		{"default not a choice", CatalogCommand{Name: "deploy", Flags: []CatalogFlag{{Name: "--env", Type: "enum", Choices: []string{"dev"}, Default: "qa"}}}, `default "qa"`},
+		{"bad flag completer", CatalogCommand{Name: "deploy", Flags: []CatalogFlag{{Name: "--env", Completer: "envs"}}}, `unknown completer "envs"`},
+	} {
+		file := CatalogFile{Commands: []CatalogCommand{test.command}}
+		err := file.Validate()
+		if test.err == "" && err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		}
+		if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("%s: got %v, want an error containing %q", test.name, err, test.err)
+		}
+	}
+}
+
+func writeCatalogFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "docker-shell-catalog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+func suggestionsNamed(c *Commands, parent string, text string) []string {
+	suggestions := c.DockerSuggestions
+	if parent != "" {
+		suggestions = c.DockerSubSuggestions[parent]
+	}
+	descriptions := []string{}
+	for _, s := range suggestions {
+		if s.Text == text {
+			descriptions = append(descriptions, s.Description)
+		}
+	}
+
+	return descriptions
+}
+
+func TestLoadDirOverridesAndMerges(t *testing.T) {
+	dir := writeCatalogFiles(t, map[string]string{
+		"10-team.yaml": `
+commands:
+  - name: deploy
+    description: Deploy the team stack
+    examples: ["deploy staging"]
+  - name: run
+    description: Run a container the team way
+    flags:
+      - name: --restart
+        type: enum
+        choices: [no, always]
+`,
+		"20-override.json": `{"commands": [{"name": "deploy", "description": "Deploy anything", "examples": ["deploy prod"]}]}`,
+		"30-broken.yml":    "commands:\n  - name: deploy\n    completer: clusters\n",
+		"40-unknown.yml":   "commands:\n  - name: deploy\n    colour: red\n",
+		"notes.txt":        "not a catalog",
+	})
+	defer os.RemoveAll(dir)
+
+	c := New()
+	errs := c.LoadDir(dir)
+	if len(errs) != 2 || !strings.Contains(errs[0].Error(), "30-broken.yml") || !strings.Contains(errs[1].Error(), "40-unknown.yml") {
+		t.Fatalf("unexpected errors %v", errs)
+	}
+
+	// a command defined twice is listed once, the later file wins
+	if got := suggestionsNamed(&c, "", "deploy"); len(got) != 1 || got[0] != "Deploy anything" {
+		t.Errorf("deploy is suggested as %v", got)
+	}
+	if got := c.Examples["deploy"]; len(got) != 2 {
+		t.Errorf("deploy examples are %v", got)
+	}
+
+	// bundled commands and flags are overridden in place
+	if got := suggestionsNamed(&c, "", "run"); len(got) != 1 || got[0] != "Run a container the team way" {
+		t.Errorf("run is suggested as %v", got)
+	}
+	if got := suggestionsNamed(&c, "run", "--restart"); len(got) != 1 || got[0] == "" {
+		t.Errorf("run --restart is suggested as %v", got)
+	}
+	if spec, _ := c.GetFlagSpec("run", "--restart"); len(spec.Choices) != 2 || spec.Default != "no" {
+		t.Errorf("run --restart spec is %+v", spec)
+	}
+}
+
+func TestLoadDirMissing(t *testing.T) {
+	c := New()
+	if errs := c.LoadDir(filepath.Join(os.TempDir(), "docker-shell-missing-catalog")); len(errs) != 0 {
+		t.Errorf("a missing directory is reported as %v", errs)
+	}
+}
@@ -1,22 +1,40 @@
 package commands
 
 import (
+	"sync"
+
 	"github.com/c-bata/go-prompt"
 )
 
 type Commands struct {
 	DockerSuggestions    []prompt.Suggest
 	DockerSubSuggestions map[string][]prompt.Suggest
+	FlagSpecs            map[string]map[string]FlagSpec
+	ArgCompleters        map[string]string
+	Usages               map[string]string
+	Examples             map[string][]string
+	// MinAPIVersions are the daemon API versions commands and "command flag" pairs require
+	MinAPIVersions map[string]string
+	// EngineUnsupported are the commands a Docker compatible engine doesn't implement
+	EngineUnsupported map[string][]string
+
+	// lock guards the catalog while plugins discovered in the background are merged into it
+	lock       *sync.RWMutex
+	apiVersion string
+	engine     string
 }
 
+// New returns the bundled catalog, user catalog files are merged into it with LoadUserCatalog
 func New() Commands {
-	return Commands{
+	c := Commands{
+		lock: &sync.RWMutex{},
 		DockerSuggestions: []prompt.Suggest{
 			{Text: "attach", Description: "Attach local standard input, output, and error streams to a running container"},
 			{Text: "build", Description: "Build an image from a Dockerfile"},
 			{Text: "builder", Description: "Manage builds"},
 			{Text: "checkpoint", Description: "Manage checkpoints"},
 			{Text: "commit", Description: "Create a new image from a container’s changes"},
+			{Text: "compose", Description: "Define and run multi-container applications with Docker"},
 			{Text: "config", Description: "Manage Docker configs"},
 			{Text: "container", Description: "Manage containers"},
 			{Text: "context", Description: "Manage contexts"},
@@ -70,6 +88,13 @@ func New() Commands {
 			{Text: "volume", Description: "Manage volumes"},
 			{Text: "wait", Description: "Block until one or more containers stop, then print their exit codes"},
 			{Text: "exit", Description: "Exit command prompt"},
+			{Text: "help", Description: "Show usage, flags and examples of a command"},
+			{Text: "cache", Description: "Show statistics of or clear the completion cache"},
+			{Text: "inspect-remote", Description: "Show the manifest and config of a registry image without pulling it"},
+			{Text: "pin", Description: "Resolve image tags to their digest for reproducible deployments"},
+			{Text: "outdated", Description: "List local images whose tag points to a newer digest in the registry"},
+			{Text: "hub-status", Description: "Show the remaining Docker Hub pull quota"},
+			{Text: "about", Description: "Show the context, the daemon version and the negotiated API version"},
 		},
 		DockerSubSuggestions: map[string][]prompt.Suggest{
 			"attach": {
@@ -120,6 +145,154 @@ func New() Commands {
 				prompt.Suggest{Text: "--message", Description: "Commit message"},
 				prompt.Suggest{Text: "--pause", Description: "Pause container during commit"},
 			},
+			"cache": {
+				{Text: "clear", Description: "Remove every cached Hub, registry and image entry"},
+				{Text: "stats", Description: "Show the number of cached entries and cache hits"},
+			},
+			"inspect-remote": {},
+			"pin":            {},
+			"hub-status":     {},
+			"about":          {},
+			"outdated": {
+				{Text: "--pull", Description: "Pull the outdated images"},
+			},
+			"compose": {
+				{Text: "attach", Description: "Attach local standard input, output, and error streams to a service’s running container"},
+				{Text: "build", Description: "Build or rebuild services"},
+				{Text: "config", Description: "Parse, resolve and render compose file in canonical format"},
+				{Text: "cp", Description: "Copy files/folders between a service container and the local filesystem"},
+				{Text: "create", Description: "Creates containers for a service"},
+				{Text: "down", Description: "Stop and remove containers, networks"},
+				{Text: "events", Description: "Receive real time events from containers"},
+				{Text: "exec", Description: "Execute a command in a running container"},
+				{Text: "images", Description: "List images used by the created containers"},
+				{Text: "kill", Description: "Force stop service containers"},
+				{Text: "logs", Description: "View output from containers"},
+				{Text: "ls", Description: "List running compose projects"},
+				{Text: "pause", Description: "Pause services"},
+				{Text: "port", Description: "Print the public port for a port binding"},
+				{Text: "ps", Description: "List containers"},
+				{Text: "pull", Description: "Pull service images"},
+				{Text: "push", Description: "Push service images"},
+				{Text: "restart", Description: "Restart service containers"},
+				{Text: "rm", Description: "Removes stopped service containers"},
+				{Text: "run", Description: "Run a one-off command on a service"},
+				{Text: "start", Description: "Start services"},
+				{Text: "stop", Description: "Stop services"},
+				{Text: "top", Description: "Display the running processes"},
+				{Text: "unpause", Description: "Unpause services"},
+				{Text: "up", Description: "Create and start containers"},
+				{Text: "version", Description: "Show the Docker Compose version information"},
+				{Text: "--ansi", Description: "Control when to print ANSI control characters (“never”|”always”|”auto”)"},
+				{Text: "--env-file", Description: "Specify an alternate environment file"},
+				{Text: "--file", Description: "Compose configuration files"},
+				{Text: "--profile", Description: "Specify a profile to enable"},
+				{Text: "--progress", Description: "Set type of progress output (auto, tty, plain, quiet)"},
+				{Text: "--project-directory", Description: "Specify an alternate working directory (default: the path of the first specified Compose file)"},
+				{Text: "--project-name", Description: "Project name"},
+			},
+			"compose build": {
+				prompt.Suggest{Text: "--build-arg", Description: "Set build-time variables for services"},
+				prompt.Suggest{Text: "--no-cache", Description: "Do not use cache when building the image"},
+				prompt.Suggest{Text: "--pull", Description: "Always attempt to pull a newer version of the image"},
+				prompt.Suggest{Text: "--push", Description: "Push service images"},
+				prompt.Suggest{Text: "--quiet", Description: "Don’t print anything to STDOUT"},
+				prompt.Suggest{Text: "--ssh", Description: "Set SSH authentications used when building service images"},
+			},
+			"compose config": {
+				prompt.Suggest{Text: "--format", Description: "Format the output. Values: [yaml | json]"},
+				prompt.Suggest{Text: "--images", Description: "Print the image names, one per line"},
+				prompt.Suggest{Text: "--output", Description: "Save to file (default to stdout)"},
+				prompt.Suggest{Text: "--profiles", Description: "Print the profile names, one per line"},
+				prompt.Suggest{Text: "--quiet", Description: "Only validate the configuration, don’t print anything"},
+				prompt.Suggest{Text: "--resolve-image-digests", Description: "Pin image tags to digests"},
+				prompt.Suggest{Text: "--services", Description: "Print the service names, one per line"},
+				prompt.Suggest{Text: "--volumes", Description: "Print the volume names, one per line"},
+			},
+			"compose down": {
+				prompt.Suggest{Text: "--remove-orphans", Description: "Remove containers for services not defined in the Compose file"},
+				prompt.Suggest{Text: "--rmi", Description: "Remove images used by services (“local”|”all”)"},
+				prompt.Suggest{Text: "--timeout", Description: "Specify a shutdown timeout in seconds"},
+				prompt.Suggest{Text: "--volumes", Description: "Remove named volumes declared in the volumes section of the Compose file"},
+			},
+			"compose exec": {
+				prompt.Suggest{Text: "--detach", Description: "Detached mode: Run command in the background"},
+				prompt.Suggest{Text: "--env", Description: "Set environment variables"},
+				prompt.Suggest{Text: "--index", Description: "Index of the container if service has multiple replicas"},
+				prompt.Suggest{Text: "--no-TTY", Description: "Disable pseudo-TTY allocation"},
+				prompt.Suggest{Text: "--privileged", Description: "Give extended privileges to the process"},
+				prompt.Suggest{Text: "--user", Description: "Run the command as this user"},
+				prompt.Suggest{Text: "--workdir", Description: "Path to workdir directory for this command"},
+			},
+			"compose logs": {
+				prompt.Suggest{Text: "--follow", Description: "Follow log output"},
+				prompt.Suggest{Text: "--no-color", Description: "Produce monochrome output"},
+				prompt.Suggest{Text: "--no-log-prefix", Description: "Don’t print prefix in logs"},
+				prompt.Suggest{Text: "--since", Description: "Show logs since timestamp (e.g. 2013-01-02T13:23:37Z) or relative (e.g. 42m for 42 minutes)"},
+				prompt.Suggest{Text: "--tail", Description: "Number of lines to show from the end of the logs for each container"},
+				prompt.Suggest{Text: "--timestamps", Description: "Show timestamps"},
+				prompt.Suggest{Text: "--until", Description: "Show logs before a timestamp (e.g. 2013-01-02T13:23:37Z) or relative (e.g. 42m for 42 minutes)"},
+			},
+			"compose ls": {
+				prompt.Suggest{Text: "--all", Description: "Show all stopped Compose projects"},
+				prompt.Suggest{Text: "--filter", Description: "Filter output based on conditions provided"},
+				prompt.Suggest{Text: "--format", Description: "Format the output. Values: [table | json]"},
+				prompt.Suggest{Text: "--quiet", Description: "Only display IDs"},
+			},
+			"compose ps": {
+				prompt.Suggest{Text: "--all", Description: "Show all stopped containers (including those created by the run command)"},
+				prompt.Suggest{Text: "--filter", Description: "Filter services by a property"},
+				prompt.Suggest{Text: "--format", Description: "Format output using a custom template"},
+				prompt.Suggest{Text: "--quiet", Description: "Only display IDs"},
+				prompt.Suggest{Text: "--services", Description: "Display services"},
+				prompt.Suggest{Text: "--status", Description: "Filter services by status"},
+			},
+			"compose pull": {
+				prompt.Suggest{Text: "--ignore-buildable", Description: "Ignore images that can be built"},
+				prompt.Suggest{Text: "--ignore-pull-failures", Description: "Pull what it can and ignores images with pull failures"},
+				prompt.Suggest{Text: "--include-deps", Description: "Also pull services declared as dependencies"},
+				prompt.Suggest{Text: "--quiet", Description: "Pull without printing progress information"},
+			},
+			"compose restart": {
+				prompt.Suggest{Text: "--no-deps", Description: "Don’t restart dependent services"},
+				prompt.Suggest{Text: "--timeout", Description: "Specify a shutdown timeout in seconds"},
+			},
+			"compose rm": {
+				prompt.Suggest{Text: "--force", Description: "Don’t ask to confirm removal"},
+				prompt.Suggest{Text: "--stop", Description: "Stop the containers, if required, before removing"},
+				prompt.Suggest{Text: "--volumes", Description: "Remove any anonymous volumes attached to containers"},
+			},
+			"compose run": {
+				prompt.Suggest{Text: "--build", Description: "Build image before starting container"},
+				prompt.Suggest{Text: "--detach", Description: "Run container in background and print container ID"},
+				prompt.Suggest{Text: "--entrypoint", Description: "Override the entrypoint of the image"},
+				prompt.Suggest{Text: "--env", Description: "Set environment variables"},
+				prompt.Suggest{Text: "--name", Description: "Assign a name to the container"},
+				prompt.Suggest{Text: "--no-deps", Description: "Don’t start linked services"},
+				prompt.Suggest{Text: "--publish", Description: "Publish a container’s port(s) to the host"},
+				prompt.Suggest{Text: "--rm", Description: "Automatically remove the container when it exits"},
+				prompt.Suggest{Text: "--service-ports", Description: "Run command with all service’s ports enabled and mapped to the host"},
+				prompt.Suggest{Text: "--user", Description: "Run as specified username or uid"},
+				prompt.Suggest{Text: "--volume", Description: "Bind mount a volume"},
+				prompt.Suggest{Text: "--workdir", Description: "Working directory inside the container"},
+			},
+			"compose stop": {
+				prompt.Suggest{Text: "--timeout", Description: "Specify a shutdown timeout in seconds"},
+			},
+			"compose up": {
+				prompt.Suggest{Text: "--abort-on-container-exit", Description: "Stops all containers if any container was stopped"},
+				prompt.Suggest{Text: "--build", Description: "Build images before starting containers"},
+				prompt.Suggest{Text: "--detach", Description: "Detached mode: Run containers in the background"},
+				prompt.Suggest{Text: "--force-recreate", Description: "Recreate containers even if their configuration and image haven’t changed"},
+				prompt.Suggest{Text: "--no-build", Description: "Don’t build an image, even if it’s policy"},
+				prompt.Suggest{Text: "--no-deps", Description: "Don’t start linked services"},
+				prompt.Suggest{Text: "--no-recreate", Description: "If containers already exist, don’t recreate them"},
+				prompt.Suggest{Text: "--pull", Description: "Pull image before running (“always”|”missing”|”never”)"},
+				prompt.Suggest{Text: "--remove-orphans", Description: "Remove containers for services not defined in the Compose file"},
+				prompt.Suggest{Text: "--scale", Description: "Scale SERVICE to NUM instances"},
+				prompt.Suggest{Text: "--timeout", Description: "Use this timeout in seconds for container shutdown"},
+				prompt.Suggest{Text: "--wait", Description: "Wait for services to be running|healthy"},
+			},
 			"cp": {
 				prompt.Suggest{Text: "--archive", Description: "Archive mode (copy all uid/gid information)"},
 				prompt.Suggest{Text: "--follow-link", Description: "Always follow symbol link in SRC_PATH"},
@@ -436,8 +609,118 @@ func New() Commands {
 				prompt.Suggest{Text: "--stars", Description: ""},
 			},
 			"stack": {
-				prompt.Suggest{Text: "--kubeconfig", Description: ""},
-				prompt.Suggest{Text: "--orchestrator", Description: "Orchestrator to use (swarm|kubernetes|all)"},
+				{Text: "deploy", Description: "Deploy a new stack or update an existing stack"},
+				{Text: "ls", Description: "List stacks"},
+				{Text: "ps", Description: "List the tasks in the stack"},
+				{Text: "rm", Description: "Remove one or more stacks"},
+				{Text: "services", Description: "List the services in the stack"},
+				{Text: "--kubeconfig", Description: ""},
+				{Text: "--orchestrator", Description: "Orchestrator to use (swarm|kubernetes|all)"},
+			},
+			"stack deploy": {
+				prompt.Suggest{Text: "--compose-file", Description: "Path to a Compose file, or “-” to read from stdin"},
+				prompt.Suggest{Text: "--prune", Description: "Prune services that are no longer referenced"},
+				prompt.Suggest{Text: "--resolve-image", Description: "Query the registry to resolve image digest and supported platforms (“always”|”changed”|”never”)"},
+				prompt.Suggest{Text: "--with-registry-auth", Description: "Send registry authentication details to Swarm agents"},
+			},
+			"stack ls": {
+				prompt.Suggest{Text: "--format", Description: "Pretty-print stacks using a Go template"},
+			},
+			"stack ps": {
+				prompt.Suggest{Text: "--filter", Description: "Filter output based on conditions provided"},
+				prompt.Suggest{Text: "--format", Description: "Pretty-print tasks using a Go template"},
+				prompt.Suggest{Text: "--no-resolve", Description: "Do not map IDs to Names"},
+				prompt.Suggest{Text: "--no-trunc", Description: "Do not truncate output"},
+				prompt.Suggest{Text: "--quiet", Description: "Only display task IDs"},
+			},
+			"stack rm": {},
+			"stack services": {
+				prompt.Suggest{Text: "--filter", Description: "Filter output based on conditions provided"},
+				prompt.Suggest{Text: "--format", Description: "Pretty-print services using a Go template"},
+				prompt.Suggest{Text: "--quiet", Description: "Only display IDs"},
+			},
+			"context": {
+				{Text: "create", Description: "Create a context"},
+				{Text: "inspect", Description: "Display detailed information on one or more contexts"},
+				{Text: "ls", Description: "List contexts"},
+				{Text: "rm", Description: "Remove one or more contexts"},
+				{Text: "use", Description: "Connect the shell to a context, config.json is left unchanged"},
+			},
+			"context inspect": {
+				{Text: "--format", Description: "Format the output using the given Go template"},
+			},
+			"context rm": {
+				{Text: "--force", Description: "Force the removal of a context in use"},
+			},
+			"context use": {},
+			"network": {
+				{Text: "connect", Description: "Connect a container to a network"},
+				{Text: "create", Description: "Create a network"},
+				{Text: "disconnect", Description: "Disconnect a container from a network"},
+				{Text: "inspect", Description: "Display detailed information on one or more networks"},
+				{Text: "ls", Description: "List networks"},
+				{Text: "prune", Description: "Remove all unused networks"},
+				{Text: "rm", Description: "Remove one or more networks"},
+			},
+			"network connect": {
+				{Text: "--alias", Description: "Add network-scoped alias for the container"},
+				{Text: "--ip", Description: "IPv4 address (e.g., 172.30.100.104)"},
+			},
+			"network disconnect": {
+				{Text: "--force", Description: "Force the container to disconnect from a network"},
+			},
+			"network inspect": {
+				{Text: "--format", Description: "Format the output using the given Go template"},
+			},
+			"network rm": {},
+			"volume": {
+				{Text: "create", Description: "Create a volume"},
+				{Text: "inspect", Description: "Display detailed information on one or more volumes"},
+				{Text: "ls", Description: "List volumes"},
+				{Text: "prune", Description: "Remove all unused local volumes"},
+				{Text: "rm", Description: "Remove one or more volumes"},
+			},
+			"volume inspect": {
+				{Text: "--format", Description: "Format the output using the given Go template"},
+			},
+			"volume rm": {
+				{Text: "--force", Description: "Force the removal of one or more volumes"},
+			},
+			"node": {
+				{Text: "demote", Description: "Demote one or more nodes from manager in the swarm"},
+				{Text: "inspect", Description: "Display detailed information on one or more nodes"},
+				{Text: "ls", Description: "List nodes in the swarm"},
+				{Text: "promote", Description: "Promote one or more nodes to manager in the swarm"},
+				{Text: "ps", Description: "List tasks running on one or more nodes, defaults to current node"},
+				{Text: "rm", Description: "Remove one or more nodes from the swarm"},
+				{Text: "update", Description: "Update a node"},
+			},
+			"node demote": {},
+			"node inspect": {
+				prompt.Suggest{Text: "--format", Description: "Format the output using the given Go template"},
+				prompt.Suggest{Text: "--pretty", Description: "Print the information in a human friendly format"},
+			},
+			"node ls": {
+				prompt.Suggest{Text: "--filter", Description: "Filter output based on conditions provided"},
+				prompt.Suggest{Text: "--format", Description: "Pretty-print nodes using a Go template"},
+				prompt.Suggest{Text: "--quiet", Description: "Only display IDs"},
+			},
+			"node promote": {},
+			"node ps": {
+				prompt.Suggest{Text: "--filter", Description: "Filter output based on conditions provided"},
+				prompt.Suggest{Text: "--format", Description: "Pretty-print tasks using a Go template"},
+				prompt.Suggest{Text: "--no-resolve", Description: "Do not map IDs to Names"},
+				prompt.Suggest{Text: "--no-trunc", Description: "Do not truncate output"},
+				prompt.Suggest{Text: "--quiet", Description: "Only display task IDs"},
+			},
+			"node rm": {
+				prompt.Suggest{Text: "--force", Description: "Force remove a node from the swarm"},
+			},
+			"node update": {
+				prompt.Suggest{Text: "--availability", Description: "Availability of the node (“active”|”pause”|”drain”)"},
+				prompt.Suggest{Text: "--label-add", Description: "Add or update a node label (key=value)"},
+				prompt.Suggest{Text: "--label-rm", Description: "Remove a node label if exists"},
+				prompt.Suggest{Text: "--role", Description: "Role of the node (“worker”|”manager”)"},
 			},
 			"start": {
 				prompt.Suggest{Text: "--attach", Description: "Attach STDOUT/STDERR and forward signals"},
@@ -583,6 +866,7 @@ func New() Commands {
 				prompt.Suggest{Text: "--no-trunc", Description: "Do not truncate output"},
 				prompt.Suggest{Text: "--quiet", Description: "Only display task IDs"},
 			},
+			"service rm": {},
 			"service rollback": {
 				prompt.Suggest{Text: "--detach", Description: "Exit immediately instead of waiting for the service to converge"},
 				prompt.Suggest{Text: "--quiet", Description: "Suppress progress output"},
@@ -677,11 +961,263 @@ func New() Commands {
 				prompt.Suggest{Text: "--workdir", Description: "Working directory inside the container"},
 			},
 		},
+		FlagSpecs: map[string]map[string]FlagSpec{
+			"run": {
+				"--cpus":      {Type: "string"},
+				"--env":       {Type: "list"},
+				"--memory":    {Type: "bytes"},
+				"--name":      {Type: "string"},
+				"--network":   {Type: "string", Default: "bridge", Completer: "networks"},
+				"--publish":   {Type: "list"},
+				"--restart":   {Type: "enum", Choices: []string{"no", "on-failure", "always", "unless-stopped"}, Default: "no"},
+				"--user":      {Type: "string"},
+				"--volume":    {Type: "list"},
+				"--workdir":   {Type: "string"},
+				"--detach":    {Type: "bool"},
+				"--rm":        {Type: "bool"},
+				"--tty":       {Type: "bool"},
+				"--init":      {Type: "bool"},
+				"--read-only": {Type: "bool"},
+			},
+			"logs": {
+				"--follow":     {Type: "bool"},
+				"--since":      {Type: "string"},
+				"--tail":       {Type: "string", Default: "all"},
+				"--timestamps": {Type: "bool"},
+				"--until":      {Type: "string"},
+			},
+			"ps": {
+				"--all":      {Type: "bool"},
+				"--filter":   {Type: "list"},
+				"--format":   {Type: "string"},
+				"--last":     {Type: "int", Default: "-1"},
+				"--quiet":    {Type: "bool"},
+				"--size":     {Type: "bool"},
+				"--no-trunc": {Type: "bool"},
+			},
+			"stop": {
+				"--time": {Type: "int", Default: "10"},
+			},
+			"compose up": {
+				"--detach":  {Type: "bool"},
+				"--build":   {Type: "bool"},
+				"--pull":    {Type: "enum", Choices: []string{"always", "missing", "never"}, Default: "missing"},
+				"--scale":   {Type: "list"},
+				"--timeout": {Type: "int"},
+			},
+			"service scale": {
+				"--detach": {Type: "bool"},
+			},
+			"node update": {
+				"--availability": {Type: "enum", Choices: []string{"active", "pause", "drain"}},
+				"--label-add":    {Type: "list"},
+				"--label-rm":     {Type: "list"},
+				"--role":         {Type: "enum", Choices: []string{"worker", "manager"}},
+			},
+			"service logs": {
+				"--since": {Type: "string"},
+				"--tail":  {Type: "string", Default: "all"},
+			},
+			"stack deploy": {
+				"--compose-file":  {Type: "list"},
+				"--resolve-image": {Type: "enum", Choices: []string{"always", "changed", "never"}, Default: "always"},
+			},
+		},
+		ArgCompleters: map[string]string{
+			"context inspect":    "contexts",
+			"context rm":         "contexts",
+			"context use":        "contexts",
+			"network connect":    "networks",
+			"network disconnect": "networks",
+			"network inspect":    "networks",
+			"network rm":         "networks",
+			"volume inspect":     "volumes",
+			"volume rm":          "volumes",
+			"node demote":        "nodes",
+			"node inspect":       "nodes",
+			"node promote":       "nodes",
+			"node ps":            "nodes",
+			"node rm":            "nodes",
+			"node update":        "nodes",
+			"service inspect":    "services",
+			"service logs":       "services-and-tasks",
+			"service ps":         "services",
+			"service rm":         "services",
+			"service rollback":   "services",
+			"service scale":      "service-scales",
+			"service update":     "services",
+			"stack ps":           "stacks",
+			"stack rm":           "stacks",
+			"stack services":     "stacks",
+		},
+		Usages: map[string]string{
+			"attach":           "docker attach [OPTIONS] CONTAINER",
+			"build":            "docker build [OPTIONS] PATH | URL | -",
+			"commit":           "docker commit [OPTIONS] CONTAINER [REPOSITORY[:TAG]]",
+			"compose":          "docker compose [OPTIONS] COMMAND",
+			"compose down":     "docker compose down [OPTIONS] [SERVICES]",
+			"compose exec":     "docker compose exec [OPTIONS] SERVICE COMMAND [ARGS...]",
+			"compose logs":     "docker compose logs [OPTIONS] [SERVICE...]",
+			"compose ps":       "docker compose ps [OPTIONS] [SERVICE...]",
+			"compose run":      "docker compose run [OPTIONS] SERVICE [COMMAND] [ARGS...]",
+			"compose up":       "docker compose up [OPTIONS] [SERVICE...]",
+			"context":          "docker context COMMAND",
+			"context inspect":  "docker context inspect [OPTIONS] [CONTEXT] [CONTEXT...]",
+			"context rm":       "docker context rm CONTEXT [CONTEXT...]",
+			"context use":      "context use CONTEXT",
+			"cp":               "docker cp [OPTIONS] CONTAINER:SRC_PATH DEST_PATH|-",
+			"create":           "docker create [OPTIONS] IMAGE [COMMAND] [ARG...]",
+			"events":           "docker events [OPTIONS]",
+			"exec":             "docker exec [OPTIONS] CONTAINER COMMAND [ARG...]",
+			"export":           "docker export [OPTIONS] CONTAINER",
+			"history":          "docker history [OPTIONS] IMAGE",
+			"images":           "docker images [OPTIONS] [REPOSITORY[:TAG]]",
+			"import":           "docker import [OPTIONS] file|URL|- [REPOSITORY[:TAG]]",
+			"info":             "docker info [OPTIONS]",
+			"inspect":          "docker inspect [OPTIONS] NAME|ID [NAME|ID...]",
+			"kill":             "docker kill [OPTIONS] CONTAINER [CONTAINER...]",
+			"load":             "docker load [OPTIONS]",
+			"login":            "docker login [OPTIONS] [SERVER]",
+			"logs":             "docker logs [OPTIONS] CONTAINER",
+			"port":             "docker port CONTAINER [PRIVATE_PORT[/PROTO]]",
+			"ps":               "docker ps [OPTIONS]",
+			"network":          "docker network COMMAND",
+			"network connect":  "docker network connect [OPTIONS] NETWORK CONTAINER",
+			"network inspect":  "docker network inspect [OPTIONS] NETWORK [NETWORK...]",
+			"network rm":       "docker network rm NETWORK [NETWORK...]",
+			"pull":             "docker pull [OPTIONS] NAME[:TAG|@DIGEST]",
+			"push":             "docker push [OPTIONS] NAME[:TAG]",
+			"restart":          "docker restart [OPTIONS] CONTAINER [CONTAINER...]",
+			"rm":               "docker rm [OPTIONS] CONTAINER [CONTAINER...]",
+			"rmi":              "docker rmi [OPTIONS] IMAGE [IMAGE...]",
+			"run":              "docker run [OPTIONS] IMAGE [COMMAND] [ARG...]",
+			"save":             "docker save [OPTIONS] IMAGE [IMAGE...]",
+			"search":           "docker search [OPTIONS] TERM",
+			"service":          "docker service COMMAND",
+			"service create":   "docker service create [OPTIONS] IMAGE [COMMAND] [ARG...]",
+			"service inspect":  "docker service inspect [OPTIONS] SERVICE [SERVICE...]",
+			"service logs":     "docker service logs [OPTIONS] SERVICE|TASK",
+			"service ls":       "docker service ls [OPTIONS]",
+			"service ps":       "docker service ps [OPTIONS] SERVICE [SERVICE...]",
+			"service rm":       "docker service rm SERVICE [SERVICE...]",
+			"service rollback": "docker service rollback [OPTIONS] SERVICE",
+			"service scale":    "docker service scale SERVICE=REPLICAS [SERVICE=REPLICAS...]",
+			"service update":   "docker service update [OPTIONS] SERVICE",
+			"stack":            "docker stack [OPTIONS] COMMAND",
+			"start":            "docker start [OPTIONS] CONTAINER [CONTAINER...]",
+			"stats":            "docker stats [OPTIONS] [CONTAINER...]",
+			"stop":             "docker stop [OPTIONS] CONTAINER [CONTAINER...]",
+			"update":           "docker update [OPTIONS] CONTAINER [CONTAINER...]",
+			"version":          "docker version [OPTIONS]",
+			"volume":           "docker volume COMMAND",
+			"volume inspect":   "docker volume inspect [OPTIONS] VOLUME [VOLUME...]",
+			"volume rm":        "docker volume rm [OPTIONS] VOLUME [VOLUME...]",
+			"help":             "help [COMMAND [SUBCOMMAND]]",
+			"inspect-remote":   "inspect-remote NAME[:TAG|@DIGEST]",
+			"pin":              "pin NAME[:TAG] [NAME[:TAG]...]",
+			"outdated":         "outdated [--pull]",
+			"hub-status":       "hub-status",
+			"about":            "about",
+			"@":                "@CONTEXT[,CONTEXT...]|@all COMMAND [ARG...]",
+		},
+		Examples: map[string][]string{
+			"build": {
+				"docker build -t myapp:latest .",
+				"docker build -f Dockerfile.dev --build-arg VERSION=1.2 -t myapp:dev .",
+			},
+			"compose up": {
+				"docker compose up -d",
+				"docker compose --profile debug up --build web",
+			},
+			"compose logs": {
+				"docker compose logs -f --tail 100 web",
+			},
+			"context use": {
+				"context use production",
+			},
+			"@": {
+				"@staging,production ps",
+				"@all image prune -f",
+			},
+			"cp": {
+				"docker cp web:/etc/nginx/nginx.conf ./nginx.conf",
+			},
+			"exec": {
+				"docker exec -it web sh",
+				"docker exec -u root web cat /etc/os-release",
+			},
+			"logs": {
+				"docker logs -f --tail 100 web",
+				"docker logs --since 10m web",
+			},
+			"ps": {
+				"docker ps -a --filter status=exited",
+				"docker ps --format '{{.Names}}\t{{.Status}}'",
+			},
+			"inspect-remote": {
+				"inspect-remote nginx:alpine",
+				"inspect-remote registry.example.com/team/api@sha256:...",
+			},
+			"pin": {
+				"pin nginx:alpine redis",
+			},
+			"pull": {
+				"docker pull nginx:alpine",
+				"docker pull --platform linux/arm64 redis",
+			},
+			"rm": {
+				"docker rm -f web",
+			},
+			"run": {
+				"docker run -it --rm alpine sh",
+				"docker run -d --name web -p 8080:80 --restart unless-stopped nginx",
+				"docker run --rm -v \"$PWD\":/src -w /src golang go test ./...",
+			},
+			"service scale": {
+				"docker service scale web=3 worker=5",
+			},
+			"stop": {
+				"docker stop -t 30 web",
+			},
+		},
+		MinAPIVersions: map[string]string{
+			"builder":               "1.31",
+			"checkpoint":            "1.25",
+			"config":                "1.30",
+			"node":                  "1.24",
+			"plugin":                "1.25",
+			"secret":                "1.25",
+			"service":               "1.24",
+			"service logs":          "1.29",
+			"service rollback":      "1.31",
+			"stack":                 "1.25",
+			"swarm":                 "1.24",
+			"system":                "1.25",
+			"network prune":         "1.25",
+			"volume prune":          "1.25",
+			"build --platform":      "1.32",
+			"build --squash":        "1.25",
+			"create --platform":     "1.32",
+			"pull --platform":       "1.32",
+			"run --cgroupns":        "1.41",
+			"run --gpus":            "1.40",
+			"run --init":            "1.25",
+			"run --platform":        "1.32",
+			"service create --init": "1.37",
+		},
+		EngineUnsupported: map[string][]string{
+			"podman": {"builder", "checkpoint", "config", "node", "plugin", "service", "stack", "swarm", "trust"},
+		},
 	}
+
+	return c
 }
 
 func (c *Commands) GetDockerSuggestions() []prompt.Suggest {
-	return c.DockerSuggestions
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.supportedSuggestions("", c.DockerSuggestions)
 }
 
 func (c *Commands) GetDockerSubSuggestions() map[string][]prompt.Suggest {
@@ -689,6 +1225,13 @@ func (c *Commands) GetDockerSubSuggestions() map[string][]prompt.Suggest {
 }
 
 func (c *Commands) IsDockerCommand(kw string) bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.isDockerCommand(kw)
+}
+
+func (c *Commands) isDockerCommand(kw string) bool {
 	for _, cmd := range c.DockerSuggestions {
 		if cmd.Text == kw {
 			return true
@@ -699,6 +1242,17 @@ func (c *Commands) IsDockerCommand(kw string) bool {
 }
 
 func (c *Commands) IsDockerSubCommand(kw string) ([]prompt.Suggest, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
 	val, ok := c.DockerSubSuggestions[kw]
-	return val, ok
+	return c.supportedSuggestions(kw, val), ok
+}
+
+// Usage returns the usage line of a command
+func (c *Commands) Usage(command string) string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.Usages[command]
 }
@@ -0,0 +1,144 @@
+package commands
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/c-bata/go-prompt"
+)
+
+// Describe returns the one-line description of a command or subcommand
+func (c *Commands) Describe(command string) string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.describe(command)
+}
+
+func (c *Commands) describe(command string) string {
+	parts := strings.Fields(command)
+	if len(parts) == 0 {
+		return ""
+	}
+
+	siblings := c.DockerSuggestions
+	if len(parts) > 1 {
+		siblings = c.DockerSubSuggestions[strings.Join(parts[:len(parts)-1], " ")]
+	}
+	for _, s := range siblings {
+		if s.Text == parts[len(parts)-1] {
+			return s.Description
+		}
+	}
+
+	return ""
+}
+
+// Help renders the catalog entry of a command: usage, description, subcommands, flags grouped by value type and examples.
+// Without a command it lists every top level command.
+func (c *Commands) Help(command string) (string, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	command = strings.Join(strings.Fields(command), " ")
+	b := &strings.Builder{}
+
+	if command == "" {
+		fmt.Fprintf(b, "Usage:  %s\n\nCommands:\n", c.Usages["help"])
+		writeSuggestions(b, c.DockerSuggestions, nil)
+		return b.String(), true
+	}
+
+	entries, hasEntries := c.DockerSubSuggestions[command]
+	description := c.describe(command)
+	if !hasEntries && description == "" {
+		return "", false
+	}
+
+	usage, ok := c.Usages[command]
+	if !ok {
+		usage = "docker " + command
+		if hasEntries {
+			usage += " [OPTIONS]"
+		}
+	}
+	fmt.Fprintf(b, "Usage:  %s\n", usage)
+	if description != "" {
+		fmt.Fprintf(b, "\n%s\n", description)
+	}
+
+	subcommands := []prompt.Suggest{}
+	groups := map[string][]prompt.Suggest{}
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Text, "-") {
+			subcommands = append(subcommands, entry)
+			continue
+		}
+		spec := c.FlagSpecs[command][entry.Text]
+		groups[flagGroup(spec)] = append(groups[flagGroup(spec)], entry)
+	}
+
+	if len(subcommands) > 0 {
+		b.WriteString("\nCommands:\n")
+		writeSuggestions(b, subcommands, nil)
+	}
+
+	for _, group := range []string{"Options", "Switches", "Other flags"} {
+		if len(groups[group]) == 0 {
+			continue
+		}
+		fmt.Fprintf(b, "\n%s:\n", group)
+		writeSuggestions(b, groups[group], c.FlagSpecs[command])
+	}
+
+	if examples := c.Examples[command]; len(examples) > 0 {
+		b.WriteString("\nExamples:\n")
+		for _, example := range examples {
+			fmt.Fprintf(b, "  %s\n", example)
+		}
+	}
+
+	return b.String(), true
+}
+
+func flagGroup(spec FlagSpec) string {
+	switch spec.Type {
+	case "":
+		return "Other flags"
+	case "bool":
+		return "Switches"
+	default:
+		return "Options"
+	}
+}
+
+func writeSuggestions(b *strings.Builder, suggestions []prompt.Suggest, specs map[string]FlagSpec) {
+	sorted := make([]prompt.Suggest, len(suggestions))
+	copy(sorted, suggestions)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Text < sorted[j].Text })
+
+	names := make([]string, len(sorted))
+	width := 0
+	for i, s := range sorted {
+		names[i] = s.Text
+		if spec, ok := specs[s.Text]; ok && spec.Type != "" && spec.Type != "bool" {
+			names[i] += " " + spec.Type
+		}
+		if len(names[i]) > width {
+			width = len(names[i])
+		}
+	}
+
+	for i, s := range sorted {
+		line := fmt.Sprintf("  %-*s  %s", width, names[i], s.Description)
+		spec := specs[s.Text]
+		if len(spec.Choices) > 0 {
+			line += fmt.Sprintf(" [%s]", strings.Join(spec.Choices, "|"))
+		}
+		if spec.Default != "" {
+			line += fmt.Sprintf(" (default %s)", spec.Default)
+		}
+		b.WriteString(strings.TrimRight(line, " ") + "\n")
+	}
+}
@@ -0,0 +1,291 @@
+package commands
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/c-bata/go-prompt"
+)
+
+const pluginPrefix = "docker-"
+
+// pluginProcesses bounds the plugin binaries run at once during discovery
+const pluginProcesses = 4
+
+// PluginTimeout bounds every invocation of a plugin binary during discovery
+var PluginTimeout = 2 * time.Second
+
+// pluginSlots are taken by the plugin binaries running, a plugin with many subcommands waits for free slots
+var pluginSlots = make(chan struct{}, pluginProcesses)
+
+// PluginMetadata is the answer of a plugin to the docker-cli-plugin-metadata command
+type PluginMetadata struct {
+	SchemaVersion    string
+	Vendor           string
+	Version          string
+	ShortDescription string
+	URL              string
+}
+
+// Plugin is a docker CLI plugin found on disk
+type Plugin struct {
+	Name     string
+	Path     string
+	Metadata PluginMetadata
+}
+
+type pluginHelp struct {
+	Usage       string
+	Subcommands []prompt.Suggest
+	Flags       []prompt.Suggest
+	FlagTypes   map[string]string
+}
+
+var pluginFlagExpression = regexp.MustCompile(`^\s+(?:-[a-zA-Z0-9], )?(--[a-zA-Z0-9][\w-]*)(?: ([a-zA-Z]+))?(?:\s{2,}(.*))?$`)
+var pluginCommandExpression = regexp.MustCompile(`^\s+([a-z0-9][\w-]*)\*?(?:\s{2,}(.*))?$`)
+
+// PluginDirs returns the directories the docker CLI looks for plugins in, the user's directory first
+func PluginDirs() []string {
+	dirs := []string{}
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, ".docker", "cli-plugins"))
+	}
+
+	return append(dirs,
+		"/usr/local/lib/docker/cli-plugins",
+		"/usr/local/libexec/docker/cli-plugins",
+		"/usr/lib/docker/cli-plugins",
+		"/usr/libexec/docker/cli-plugins",
+	)
+}
+
+// FindPlugins lists the plugin binaries of dirs. A plugin found in an earlier directory shadows later ones.
+func FindPlugins(dirs []string) []Plugin {
+	seen := map[string]bool{}
+	plugins := []Plugin{}
+	for _, dir := range dirs {
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name := strings.TrimSuffix(entry.Name(), ".exe")
+			if !strings.HasPrefix(name, pluginPrefix) || entry.IsDir() || entry.Mode()&0111 == 0 {
+				continue
+			}
+			name = strings.TrimPrefix(name, pluginPrefix)
+			if name == "" || seen[name] {
+				continue
+			}
+			seen[name] = true
+			plugins = append(plugins, Plugin{Name: name, Path: filepath.Join(dir, entry.Name())})
+		}
+	}
+
+	return plugins
+}
+
+// DiscoverPlugins asks every plugin of dirs for its metadata and help and adds it to the catalog. Plugins are run
+// without holding the catalog, so it can be called in the background while the catalog is in use.
+// Binaries which don't follow the plugin protocol are skipped and reported.
+func (c *Commands) DiscoverPlugins(dirs []string) []error {
+	plugins := FindPlugins(dirs)
+	helps := make([]map[string]pluginHelp, len(plugins))
+	errs := make([]error, len(plugins))
+
+	wg := sync.WaitGroup{}
+	for i := range plugins {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			metadata, err := pluginMetadata(plugins[i].Path)
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: %v", plugins[i].Path, err)
+				return
+			}
+			plugins[i].Metadata = metadata
+			helps[i] = pluginHelps(plugins[i])
+		}(i)
+	}
+	wg.Wait()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	result := []error{}
+	for i, plugin := range plugins {
+		if errs[i] != nil {
+			result = append(result, errs[i])
+			continue
+		}
+		c.addPlugin(plugin, helps[i])
+	}
+
+	return result
+}
+
+func (c *Commands) addPlugin(plugin Plugin, helps map[string]pluginHelp) {
+	description := plugin.Metadata.ShortDescription
+	details := strings.TrimSpace(strings.Join([]string{plugin.Metadata.Vendor, plugin.Metadata.Version}, " "))
+	if details != "" {
+		description = strings.TrimSpace(fmt.Sprintf("%s (%s)", description, details))
+	}
+	c.DockerSuggestions = upsertSuggest(c.DockerSuggestions, plugin.Name, description)
+
+	names := make([]string, 0, len(helps))
+	for name := range helps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		help := helps[name]
+		if _, ok := c.Usages[name]; !ok && help.Usage != "" {
+			c.Usages[name] = help.Usage
+		}
+		if len(help.Subcommands)+len(help.Flags) == 0 {
+			continue
+		}
+
+		entries := c.DockerSubSuggestions[name]
+		for _, s := range help.Subcommands {
+			entries = upsertSuggest(entries, s.Text, s.Description)
+		}
+		for _, s := range help.Flags {
+			entries = upsertSuggest(entries, s.Text, s.Description)
+		}
+		c.DockerSubSuggestions[name] = entries
+
+		if _, ok := c.FlagSpecs[name]; !ok {
+			c.FlagSpecs[name] = map[string]FlagSpec{}
+		}
+		for flag, valueType := range help.FlagTypes {
+			if _, ok := c.FlagSpecs[name][flag]; !ok {
+				c.FlagSpecs[name][flag] = FlagSpec{Type: valueType}
+			}
+		}
+	}
+}
+
+func pluginMetadata(path string) (PluginMetadata, error) {
+	metadata := PluginMetadata{}
+	output, err := runPlugin(path, "docker-cli-plugin-metadata")
+	if err != nil {
+		return metadata, err
+	}
+
+	if err := json.Unmarshal(output, &metadata); err != nil {
+		return metadata, fmt.Errorf("invalid plugin metadata: %v", err)
+	}
+	if metadata.SchemaVersion == "" {
+		return metadata, fmt.Errorf("invalid plugin metadata: missing SchemaVersion")
+	}
+
+	return metadata, nil
+}
+
+// pluginHelps parses the help of the plugin and of each of its subcommands, keyed by catalog command
+func pluginHelps(plugin Plugin) map[string]pluginHelp {
+	helps := map[string]pluginHelp{}
+	output, err := runPlugin(plugin.Path, plugin.Name, "--help")
+	if err != nil && len(output) == 0 {
+		return helps
+	}
+	root := parsePluginHelp(output)
+	helps[plugin.Name] = root
+
+	lock := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	for _, sub := range root.Subcommands {
+		wg.Add(1)
+		go func(sub string) {
+			defer wg.Done()
+			output, err := runPlugin(plugin.Path, plugin.Name, sub, "--help")
+			if err != nil && len(output) == 0 {
+				return
+			}
+			help := parsePluginHelp(output)
+			lock.Lock()
+			helps[plugin.Name+" "+sub] = help
+			lock.Unlock()
+		}(sub.Text)
+	}
+	wg.Wait()
+
+	return helps
+}
+
+func runPlugin(path string, args ...string) ([]byte, error) {
+	pluginSlots <- struct{}{}
+	defer func() { <-pluginSlots }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), PluginTimeout)
+	defer cancel()
+
+	return exec.CommandContext(ctx, path, args...).Output()
+}
+
+// parsePluginHelp reads the usage line, commands and flags of cobra styled help output
+func parsePluginHelp(output []byte) pluginHelp {
+	help := pluginHelp{FlagTypes: map[string]string{}}
+	section := ""
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+
+		if strings.HasPrefix(trimmed, "Usage:") {
+			help.Usage = strings.TrimSpace(strings.TrimPrefix(trimmed, "Usage:"))
+			continue
+		}
+		if trimmed == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, " ") && strings.HasSuffix(trimmed, ":") {
+			section = strings.ToLower(trimmed)
+			continue
+		}
+
+		switch {
+		case strings.Contains(section, "commands"):
+			if match := pluginCommandExpression.FindStringSubmatch(line); match != nil && match[1] != "help" {
+				help.Subcommands = append(help.Subcommands, prompt.Suggest{Text: match[1], Description: match[2]})
+			}
+		case strings.Contains(section, "options") || strings.Contains(section, "flags"):
+			if match := pluginFlagExpression.FindStringSubmatch(line); match != nil && match[1] != "--help" {
+				help.Flags = append(help.Flags, prompt.Suggest{Text: match[1], Description: match[3]})
+				help.FlagTypes[match[1]] = pluginValueType(match[2])
+			}
+		}
+	}
+
+	return help
+}
+
+func pluginValueType(cobraType string) string {
+	switch cobraType {
+	case "":
+		return "bool"
+	case "int", "int32", "int64", "uint", "uint64":
+		return "int"
+	case "duration":
+		return "duration"
+	case "bytes":
+		return "bytes"
+	case "list", "stringArray", "strings", "stringSlice", "map":
+		return "list"
+	default:
+		return "string"
+	}
+}
@@ -0,0 +1,191 @@
+package commands
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/c-bata/go-prompt"
+)
+
+// buildxHelp and buildxBuildHelp are captured from `docker-buildx buildx --help` and `docker-buildx buildx build --help`
+const buildxHelp = `
+Usage:  docker buildx [OPTIONS] COMMAND
+
+Extended build capabilities with BuildKit
+
+Options:
+      --builder string   Override the configured builder instance
+  -D, --debug            Enable debug logging
+
+Management Commands:
+  imagetools  Commands to work on images in registry
+
+Commands:
+  bake        Build from a file
+  build*      Start a build
+  ls          List builder instances
+
+Run 'docker buildx COMMAND --help' for more information on a command.
+`
+
+const buildxBuildHelp = `
+Usage:  docker buildx build [OPTIONS] PATH | URL | -
+
+Start a build
+
+Aliases:
+  docker buildx build, docker buildx b
+
+Options:
+      --add-host strings              Add a custom host-to-IP mapping
+      --build-arg stringArray         Set build-time variables
+  -f, --file string                   Name of the Dockerfile
+  -h, --help                          help for build
+      --load                          Shorthand for "--output=type=docker"
+      --shm-size bytes                Shared memory size for build containers
+      --ulimit ulimit                 Ulimit options (default [])
+`
+
+func TestParsePluginHelp(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		output string
+		want   pluginHelp
+	}{
+		{"root", buildxHelp, pluginHelp{
+			Usage: "docker buildx [OPTIONS] COMMAND",
+			Subcommands: []prompt.Suggest{
+				{Text: "imagetools", Description: "Commands to work on images in registry"},
+				{Text: "bake", Description: "Build from a file"},
+				{Text: "build", Description: "Start a build"},
+				{Text: "ls", Description: "List builder instances"},
+			},
+			Flags: []prompt.Suggest{
+				{Text: "--builder", Description: "Override the configured builder instance"},
+				{Text: "--debug", Description: "Enable debug logging"},
+			},
+			FlagTypes: map[string]string{"--builder": "string", "--debug": "bool"},
+		}},
+		{"subcommand", buildxBuildHelp, pluginHelp{
+			Usage: "docker buildx build [OPTIONS] PATH | URL | -",
+			Flags: []prompt.Suggest{
+				{Text: "--add-host", Description: "Add a custom host-to-IP mapping"},
+				{Text: "--build-arg", Description: "Set build-time variables"},
+				{Text: "--file", Description: "Name of the Dockerfile"},
+				{Text: "--load", Description: `Shorthand for "--output=type=docker"`},
+				{Text: "--shm-size", Description: "Shared memory size for build containers"},
+				{Text: "--ulimit", Description: "Ulimit options (default [])"},
+			},
+			FlagTypes: map[string]string{
+				"--add-host": "list", "--build-arg": "list", "--file": "string", "--load": "bool", "--shm-size": "bytes", "--ulimit": "string",
+			},
+		}},
+		{"not cobra", "plain text\nwithout sections\n", pluginHelp{FlagTypes: map[string]string{}}},
+	} {
+		if got := parsePluginHelp([]byte(test.output)); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestFindPlugins(t *testing.T) {
+	user, system := t.TempDir(), t.TempDir()
+	write := func(dir string, name string, mode os.FileMode) {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"), mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(user, "docker-buildx", 0755)
+	write(user, "docker-notes.txt", 0644)
+	write(user, "compose", 0755)
+	write(system, "docker-buildx", 0755)
+	write(system, "docker-scan.exe", 0755)
+	write(system, "docker-", 0755)
+	os.Mkdir(filepath.Join(system, "docker-dir"), 0755)
+
+	want := []Plugin{
+		{Name: "buildx", Path: filepath.Join(user, "docker-buildx")},
+		{Name: "scan", Path: filepath.Join(system, "docker-scan.exe")},
+	}
+	if got := FindPlugins([]string{user, filepath.Join(user, "missing"), system}); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+// writePlugin writes a plugin script answering the metadata command with metadata and --help with the captured help.
+// Every subcommand help records how many plugin processes were running in log.
+func writePlugin(t *testing.T, dir string, name string, metadata string, subcommands int, log string) {
+	commands := ""
+	for i := 0; i < subcommands; i++ {
+		commands += fmt.Sprintf("  sub%d        Subcommand %d\n", i, i)
+	}
+	script := `#!/bin/sh
+if [ "$1" = docker-cli-plugin-metadata ]; then
+  printf '%s' '` + metadata + `'
+  exit 0
+fi
+if [ "$2" = --help ]; then
+  printf 'Usage:  docker ` + name + ` COMMAND\n\nCommands:\n` + strings.Replace(commands, "\n", `\n`, -1) + `'
+  exit 0
+fi
+touch "` + dir + `/running.$$"
+ls "` + dir + `" | grep -c '^running\.' >> "` + log + `"
+sleep 0.2
+rm "` + dir + `/running.$$"
+printf 'Usage:  docker ` + name + ` %s [OPTIONS]\n\nOptions:\n      --all   Everything\n' "$2"
+`
+	if err := ioutil.WriteFile(filepath.Join(dir, "docker-"+name), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDiscoverPlugins(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the stand-in plugins are shell scripts")
+	}
+	dir := t.TempDir()
+	log := filepath.Join(t.TempDir(), "running.log")
+	writePlugin(t, dir, "many", `{"SchemaVersion":"0.1.0","Vendor":"Example","Version":"v1.2.0","ShortDescription":"Many subcommands"}`, 12, log)
+	writePlugin(t, dir, "broken", `not json`, 0, log)
+
+	c := New()
+	errs := c.DiscoverPlugins([]string{dir})
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "docker-broken: invalid plugin metadata") {
+		t.Errorf("errors are %v, want the broken plugin", errs)
+	}
+
+	found := false
+	for _, s := range c.GetDockerSuggestions() {
+		found = found || (s.Text == "many" && s.Description == "Many subcommands (Example v1.2.0)")
+	}
+	if !found {
+		t.Error("the plugin isn't suggested with its metadata")
+	}
+	if subcommands, _ := c.IsDockerSubCommand("many"); len(subcommands) != 12 {
+		t.Errorf("%d subcommands are suggested, want 12", len(subcommands))
+	}
+	if usage := c.Usage("many sub3"); usage != "docker many sub3 [OPTIONS]" {
+		t.Errorf("subcommand usage is %q", usage)
+	}
+
+	content, err := ioutil.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := strings.Fields(string(content))
+	if len(counts) != 12 {
+		t.Fatalf("%d subcommand helps were asked, want 12", len(counts))
+	}
+	for _, count := range counts {
+		if running, _ := strconv.Atoi(count); running > pluginProcesses {
+			t.Errorf("%d plugin processes ran at once, the limit is %d", running, pluginProcesses)
+		}
+	}
+}
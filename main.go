@@ -2,15 +2,12 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"flag"
 	"fmt"
-	"net/http"
-	"net/url"
 	"os"
 	"os/exec"
 	"reflect"
 	"regexp"
-	"strconv"
 	"strings"
 	"time"
 
@@ -19,61 +16,15 @@ import (
 	"docker.io/go-docker/api/types/registry"
 
 	"github.com/c-bata/go-prompt"
-	"github.com/hashicorp/go-retryablehttp"
 	commands "github.com/mstrYoda/docker-shell/lib"
-	"github.com/patrickmn/go-cache"
 )
 
-var dockerClient *docker.Client
 var shellCommands commands.Commands = commands.New()
 
-//DockerHubResult : Wrap DockerHub API call
-type DockerHubResult struct {
-	PageCount        *int                    `json:"num_pages,omitempty"`
-	ResultCount      *int                    `json:"num_results,omitempty"`
-	ItemCountPerPage *int                    `json:"page_size,omitempty"`
-	CurrentPage      *int                    `json:"page,omitempty"`
-	Query            *string                 `json:"query,omitempty"`
-	Items            []registry.SearchResult `json:"results,omitempty"`
-}
-
-func imageFromHubAPI(count int) []registry.SearchResult {
-	client := retryablehttp.NewClient()
-	client.HTTPClient = &http.Client{
-		Timeout: 1 * time.Second,
-	}
-	client.RetryWaitMin = client.HTTPClient.Timeout
-	client.RetryWaitMax = client.HTTPClient.Timeout
-	client.RetryMax = 3
-	client.Logger = nil
-	url := url.URL{
-		Scheme:   "https",
-		Host:     "registry.hub.docker.com",
-		Path:     "/v2/repositories/library",
-		RawQuery: "page=1&page_size=" + strconv.Itoa(count),
-	}
-	apiURL := url.String()
-	response, err := client.Get(apiURL)
-	if err != nil {
-		return nil
-	}
-
-	defer response.Body.Close()
-
-	decoder := json.NewDecoder(response.Body)
-	searchResult := &DockerHubResult{}
-	decoder.Decode(searchResult)
-	if searchResult.Items == nil || len(searchResult.Items) <= 0 {
-		return nil
-	}
-
-	return searchResult.Items
-}
-
 func imageFromContext(imageName string, count int) []registry.SearchResult {
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
-	ctxResponse, err := dockerClient.ImageSearch(ctx, imageName, types.ImageSearchOptions{Limit: count})
+	ctxResponse, err := dockerClient().ImageSearch(ctx, imageName, types.ImageSearchOptions{Limit: count})
 	if err != nil {
 		return nil
 	}
@@ -85,30 +36,39 @@ func imageFromContext(imageName string, count int) []registry.SearchResult {
 	return ctxResponse
 }
 
-func imageFetchCompleter(imageName string, count int) []prompt.Suggest {
-	searchResult := []registry.SearchResult{}
-	if imageName != "" {
-		searchResult = imageFromContext(imageName, 10)
-	} else {
-		searchResult = imageFromHubAPI(10)
+func imageFetchCompleter(word string, count int) []prompt.Suggest {
+	imageName, pages := hubQuery(word)
+	if suggestions := hubSuggestions(imageName, pages, count); len(suggestions) > 0 {
+		return suggestions
 	}
 
-	if searchResult == nil || len(searchResult) <= 0 {
-		return nil
+	// the daemon can still search through its own registry configuration when the Hub API is unreachable
+	if imageName == "" {
+		return []prompt.Suggest{}
 	}
 
+	searchResult := []registry.SearchResult{}
+	completionCache.FetchAsync(fmt.Sprintf("completer:%s", imageName), 5*time.Minute, &searchResult, func() (interface{}, error) {
+		result := imageFromContext(imageName, count)
+		if result == nil {
+			return nil, fmt.Errorf("no search result for %s", imageName)
+		}
+		return result, nil
+	})
+
 	suggestions := []prompt.Suggest{}
 	for _, s := range searchResult {
-		description := "Not Official"
+		description := "Remote community"
 		if s.IsOfficial {
-			description = "Official"
+			description = "Remote official"
 		}
 		suggestions = append(suggestions, prompt.Suggest{Text: s.Name, Description: "(" + description + ") " + s.Description})
 	}
+
 	return suggestions
 }
 
-var commandExpression = regexp.MustCompile(`(?P<command>exec|stop|start|run|service create|service inspect|service logs|service ls|service ps|service rollback|service scale|service update|service|pull|attach|build|commit|cp|create|events|export|history|images|import|info|inspect|kill|load|login|logs|ps|push|restart|rm|rmi|save|search|stack|stats|update|version)\s{1}`)
+var commandExpression = regexp.MustCompile(`(?P<command>compose|exec|stop|start|run|service create|service inspect|service logs|service ls|service ps|service rollback|service scale|service update|service|pull|attach|build|commit|cp|create|events|export|history|images|import|info|inspect|kill|load|login|logs|ps|push|restart|rm|rmi|save|search|stack|stats|update|version)\s{1}`)
 
 func getRegexGroups(text string) map[string]string {
 	if !commandExpression.Match([]byte(text)) {
@@ -125,60 +85,165 @@ func getRegexGroups(text string) map[string]string {
 	return result
 }
 
-var memoryCache = cache.New(5*time.Minute, 10*time.Minute)
+// namedCompleters are the completers catalog files can refer to by name, see commands.CompleterNames
+var namedCompleters = map[string]func(d prompt.Document) ([]prompt.Suggest, error){
+	"containers":         func(d prompt.Document) ([]prompt.Suggest, error) { return containerListCompleter(true) },
+	"running-containers": func(d prompt.Document) ([]prompt.Suggest, error) { return containerListCompleter(false) },
+	"images":             func(d prompt.Document) ([]prompt.Suggest, error) { return imagesSuggestion() },
+	"ports":              func(d prompt.Document) ([]prompt.Suggest, error) { return portMappingSuggestion() },
+	"hub-images": func(d prompt.Document) ([]prompt.Suggest, error) {
+		return imageFetchCompleter(d.GetWordBeforeCursor(), hubPageSize), nil
+	},
+	"services":           func(d prompt.Document) ([]prompt.Suggest, error) { return serviceSuggestion() },
+	"services-and-tasks": func(d prompt.Document) ([]prompt.Suggest, error) { return serviceTaskSuggestion() },
+	"service-scales":     func(d prompt.Document) ([]prompt.Suggest, error) { return serviceScaleSuggestion() },
+	"nodes":              func(d prompt.Document) ([]prompt.Suggest, error) { return nodeSuggestion() },
+	"stacks":             func(d prompt.Document) ([]prompt.Suggest, error) { return stackSuggestion() },
+	"networks":           func(d prompt.Document) ([]prompt.Suggest, error) { return networkSuggestion() },
+	"volumes":            func(d prompt.Document) ([]prompt.Suggest, error) { return volumeSuggestion() },
+	"contexts":           func(d prompt.Document) ([]prompt.Suggest, error) { return contextSuggestion() },
+}
 
-func getFromCache(word string) []prompt.Suggest {
-	cacheKey := "all"
-	if word != "" {
-		cacheKey = fmt.Sprintf("completer:%s", word)
-	}
-	completer, found := memoryCache.Get(cacheKey)
-	if !found {
-		completer = imageFetchCompleter(word, 10)
-		if completer.([]prompt.Suggest) == nil {
-			return []prompt.Suggest{}
+// namedSuggestion runs a named completer guarded, the unavailable entry is kept whatever the user typed
+func namedSuggestion(name string, complete func(d prompt.Document) ([]prompt.Suggest, error), d prompt.Document) []prompt.Suggest {
+	// the markers of the Hub "more results" entry aren't part of what the user typed
+	word := strings.TrimRight(d.GetWordBeforeCursor(), hubMoreMarker)
+	suggestions := []prompt.Suggest{}
+	for _, s := range guardSource(name, d, func() ([]prompt.Suggest, error) { return complete(d) }) {
+		if s.Text == word || strings.HasPrefix(strings.ToLower(s.Text), strings.ToLower(word)) {
+			suggestions = append(suggestions, s)
 		}
-		memoryCache.Set(cacheKey, completer, cache.DefaultExpiration)
 	}
-	return completer.([]prompt.Suggest)
+
+	return suggestions
 }
 
-func completer(d prompt.Document) []prompt.Suggest {
+// catalogCompleter completes flag values and arguments described by the catalog value types and completers
+func catalogCompleter(command string, d prompt.Document) ([]prompt.Suggest, bool) {
 	word := d.GetWordBeforeCursor()
+	fields := strings.Fields(strings.TrimSuffix(d.TextBeforeCursor(), word))
+	if len(fields) == 0 {
+		return nil, false
+	}
 
+	if spec, ok := shellCommands.GetFlagSpec(command, fields[len(fields)-1]); ok && spec.Type != "bool" {
+		if complete, ok := namedCompleters[spec.Completer]; ok {
+			return namedSuggestion(spec.Completer, complete, d), true
+		}
+
+		suggestions := []prompt.Suggest{}
+		for _, choice := range spec.Choices {
+			suggestions = append(suggestions, prompt.Suggest{Text: choice})
+		}
+		return prompt.FilterHasPrefix(suggestions, word, true), true
+	}
+
+	if strings.HasPrefix(word, "-") {
+		return nil, false
+	}
+
+	if name, ok := shellCommands.GetArgCompleter(command); ok {
+		if complete, ok := namedCompleters[name]; ok {
+			return namedSuggestion(name, complete, d), true
+		}
+	}
+
+	return nil, false
+}
+
+// matchCommand finds the command being completed. The catalog wins over commandExpression when it knows
+// a more specific command, e.g. `node update` or plugin subcommands like `buildx build`.
+func matchCommand(d prompt.Document) (string, bool) {
 	group := getRegexGroups(d.Text)
+	catalogCommand, inCatalog := shellCommands.FindCommand(strings.TrimSuffix(d.TextBeforeCursor(), d.GetWordBeforeCursor()))
+	if _, ok := shellCommands.IsDockerSubCommand(catalogCommand); inCatalog && ok {
+		if group == nil || commandExpression.FindStringIndex(d.Text)[0] > 0 || len(catalogCommand) > len(group["command"]) {
+			return catalogCommand, true
+		}
+	}
+
 	if group != nil {
-		command := group["command"]
+		return group["command"], true
+	}
+
+	return catalogCommand, inCatalog
+}
+
+func completer(d prompt.Document) []prompt.Suggest {
+	completionEngine.observe(d)
+
+	// completers only read data loaded in the background, this catches the ones which don't
+	return guardSourceWithin("completion", completionDeadline, d, func() ([]prompt.Suggest, error) { return completeCommand(d), nil })
+}
+
+func completeCommand(d prompt.Document) []prompt.Suggest {
+	if strings.HasPrefix(d.Text, "@") {
+		if !strings.Contains(d.TextBeforeCursor(), " ") {
+			return contextTargetSuggestion(d.GetWordBeforeCursor())
+		}
+		d = withoutContextTargets(d)
+	}
+	word := d.GetWordBeforeCursor()
+
+	if strings.HasPrefix(d.TextBeforeCursor(), "help ") {
+		return helpCompleter(d)
+	}
+
+	if command, ok := matchCommand(d); ok {
+		if command == "compose" || strings.HasPrefix(command, "compose ") {
+			return composeCompleter(d)
+		}
+
+		if suggestions, ok := catalogCompleter(command, d); ok {
+			return suggestions
+		}
 
 		if command == "exec" || command == "stop" || command == "port" {
-			return containerListCompleter(false)
+			return namedSuggestion("running-containers", namedCompleters["running-containers"], d)
 		}
 
 		if command == "start" {
-			return containerListCompleter(true)
+			return namedSuggestion("containers", namedCompleters["containers"], d)
 		}
 
 		if command == "run" {
 			if word == "-p" {
-				return portMappingSuggestion()
+				return guardSource("ports", d, portMappingSuggestion)
 			}
 
-			return imagesSuggestion()
+			if strings.HasPrefix(word, "-") {
+				val, _ := shellCommands.IsDockerSubCommand(command)
+				return prompt.FilterHasPrefix(val, word, true)
+			}
+
+			if !completesImage(command, d) {
+				return []prompt.Suggest{}
+			}
+			return imageSuggestion(d, word, true)
 		}
 
 		if command == "pull" {
-			if strings.Index(word, ":") != -1 || strings.Index(word, "@") != -1 {
-				return []prompt.Suggest{}
+			if strings.HasPrefix(word, "-") {
+				val, _ := shellCommands.IsDockerSubCommand(command)
+				return prompt.FilterHasPrefix(val, word, true)
 			}
 
-			if word == "" || len(word) > 2 {
-				if len(strings.Split(d.Text, " ")) > 2 {
-					return []prompt.Suggest{}
-				}
-				return getFromCache(word)
+			if !completesImage(command, d) {
+				return []prompt.Suggest{}
 			}
+			return imageSuggestion(d, word, true)
+		}
 
-			return []prompt.Suggest{}
+		if command == "pin" {
+			return imageSuggestion(d, word, false)
+		}
+
+		if command == "inspect-remote" {
+			return imageSuggestion(d, word, false)
+		}
+
+		if command == "push" {
+			return registrySuggestion(word)
 		}
 		if val, ok := shellCommands.IsDockerSubCommand(command); ok {
 			return prompt.FilterHasPrefix(val, word, true)
@@ -188,83 +253,182 @@ func completer(d prompt.Document) []prompt.Suggest {
 	return prompt.FilterHasPrefix(shellCommands.GetDockerSuggestions(), word, true)
 }
 
-func containerListCompleter(all bool) []prompt.Suggest {
+func containerListCompleter(all bool) ([]prompt.Suggest, error) {
 	suggestions := []prompt.Suggest{}
-	ctx := context.Background()
-	cList, _ := dockerClient.ContainerList(ctx, types.ContainerListOptions{All: all})
-
-	for _, container := range cList {
+	containers, err := containerList()
+	for _, container := range containers {
+		if !all && container.State != "running" {
+			continue
+		}
 		suggestions = append(suggestions, prompt.Suggest{Text: container.ID, Description: container.Image})
 	}
 
-	return suggestions
+	return suggestions, err
 }
 
-func portMappingSuggestion() []prompt.Suggest {
-	images, _ := dockerClient.ImageList(context.Background(), types.ImageListOptions{All: true})
+// imageInspection returns the inspection of an image through the suggestion cache.
+// Image IDs are content addressed, so entries stay valid for long.
+func imageInspection(ctx context.Context, client *docker.Client, id string) (types.ImageInspect, error) {
+	inspection := types.ImageInspect{}
+	var err error
+	completionCache.Fetch("inspect:"+id, 24*time.Hour, &inspection, func() (interface{}, error) {
+		var loaded types.ImageInspect
+		loaded, _, err = client.ImageInspectWithRaw(ctx, id)
+		return loaded, err
+	})
+
+	return inspection, err
+}
+
+// portMappingSuggestion suggests the exposed ports of the local images. Images are inspected in the background,
+// the ports of the images inspected so far are shown meanwhile.
+func portMappingSuggestion() ([]prompt.Suggest, error) {
+	suggestions := []prompt.Suggest{}
+	fetchAsync("image-ports", 30*time.Second, 10*time.Second, &suggestions, func(ctx context.Context, client *docker.Client) (interface{}, error) {
+		return imagePortSuggestion(ctx, client)
+	})
+
+	return suggestions, sourceError("image-ports")
+}
+
+func imagePortSuggestion(ctx context.Context, client *docker.Client) ([]prompt.Suggest, error) {
+	images, ok := objects().Images()
+	if !ok {
+		list, err := client.ImageList(ctx, types.ImageListOptions{All: true})
+		if err != nil {
+			return nil, err
+		}
+		images = list
+	}
 	suggestions := []prompt.Suggest{}
 
 	for _, image := range images {
-		inspection, _, _ := dockerClient.ImageInspectWithRaw(context.Background(), image.ID)
+		if ctx.Err() != nil {
+			return suggestions, ctx.Err()
+		}
+		inspection, err := imageInspection(ctx, client, image.ID)
+		if err != nil || inspection.Config == nil {
+			continue
+		}
+
+		description := shortImageID(inspection.ID)
+		if len(inspection.RepoTags) > 0 {
+			description = inspection.RepoTags[0]
+		} else if len(inspection.RepoDigests) > 0 {
+			description = inspection.RepoDigests[0]
+		}
 
 		exposedPortKeys := reflect.ValueOf(inspection.Config.ExposedPorts).MapKeys()
 
 		for _, exposedPort := range exposedPortKeys {
 			portAndType := strings.Split(exposedPort.String(), "/")
+			if len(portAndType) != 2 {
+				continue
+			}
 			port := portAndType[0]
 			portType := portAndType[1]
-			suggestions = append(suggestions, prompt.Suggest{Text: fmt.Sprintf("-p %s:%s/%s", port, port, portType), Description: inspection.RepoDigests[0]})
+			suggestions = append(suggestions, prompt.Suggest{Text: fmt.Sprintf("-p %s:%s/%s", port, port, portType), Description: description})
 		}
 	}
 
-	return suggestions
+	return suggestions, nil
 }
 
-func imagesSuggestion() []prompt.Suggest {
-	images, _ := dockerClient.ImageList(context.Background(), types.ImageListOptions{All: true})
-	suggestions := []prompt.Suggest{}
-
-	for _, image := range images {
-		ins, _, _ := dockerClient.ImageInspectWithRaw(context.Background(), image.ID)
-		suggestions = append(suggestions, prompt.Suggest{Text: image.ID[7:], Description: ins.RepoDigests[0]})
-	}
+// discoverPlugins adds the docker CLI plugins to the catalog in the background, slow plugins don't delay the
+// first prompt. The plugins which couldn't be loaded are sent once discovery is done.
+func discoverPlugins() <-chan []error {
+	errs := make(chan []error, 1)
+	go func() {
+		errs <- shellCommands.DiscoverPlugins(commands.PluginDirs())
+		completionEngine.refresh()
+	}()
 
-	return suggestions
+	return errs
 }
 
 func main() {
-	dockerClient, _ = docker.NewEnvClient()
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-	defer cancel()
-
-	if _, err := dockerClient.Ping(ctx); err != nil {
-		fmt.Println("Couldn't check docker status please make sure docker is running.")
-		fmt.Println(err)
+	flag.Parse()
+	if _, err := configuredEngine(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
 		return
 	}
-	go getFromCache("")
+	catalogErrors := shellCommands.LoadUserCatalog()
+
+	if err := connectContext(currentContextName()); err != nil {
+		// the shell starts anyway, the health monitor connects once the daemon answers
+		client, dockerCtx, openErr := openContext(currentContextName())
+		if openErr != nil {
+			fmt.Println("Couldn't connect to docker:", openErr)
+			return
+		}
+		useClient(client, dockerCtx.Name, detectEngine(dockerCtx.Host, types.Version{}))
+		health.record(err)
+		fmt.Fprintln(os.Stderr, "Couldn't check docker status please make sure docker is running, completion is limited until it answers.")
+		fmt.Fprintln(os.Stderr, err)
+	}
+	go health.monitor(context.Background())
+	if settingsError != nil {
+		fmt.Fprintln(os.Stderr, "Couldn't load settings:", settingsError)
+	}
+	if transportError != nil {
+		fmt.Fprintln(os.Stderr, "Couldn't load CA bundle:", transportError)
+	}
+	for _, err := range catalogErrors {
+		fmt.Fprintln(os.Stderr, "Couldn't load catalog file:", err)
+	}
+	pluginErrors := discoverPlugins()
+
+	go hubPage("", 1, hubPageSize, true)
+	parser := completionEngine.parser()
 	for {
-		dockerCommand := prompt.Input(">>> docker ",
+		select {
+		case errs := <-pluginErrors:
+			for _, err := range errs {
+				fmt.Fprintln(os.Stderr, "Couldn't load docker CLI plugin:", err)
+			}
+		default:
+		}
+
+		completionEngine.setActive(true)
+		dockerCommand := prompt.Input(promptPrefix(),
 			completer,
+			prompt.OptionParser(parser),
 			prompt.OptionTitle("docker prompt"),
+			prompt.OptionLivePrefix(livePrefix),
 			prompt.OptionSelectedDescriptionTextColor(prompt.Turquoise),
 			prompt.OptionInputTextColor(prompt.Fuchsia),
-			prompt.OptionPrefixBackgroundColor(prompt.Cyan))
+			prompt.OptionPrefixBackgroundColor(prompt.Cyan),
+			prompt.OptionAddKeyBind(prompt.KeyBind{Key: prompt.F1, Fn: helpKeyBind}),
+			prompt.OptionAddKeyBind(prompt.KeyBind{Key: prompt.F2, Fn: pinKeyBind}),
+			prompt.OptionAddASCIICodeBind(prompt.ASCIICodeBind{ASCIICode: []byte{'?'}, Fn: helpQuestionMarkBind}))
+		completionEngine.setActive(false)
 
 		splittedDockerCommands := strings.Split(dockerCommand, " ")
 		if splittedDockerCommands[0] == "exit" {
 			os.Exit(0)
 		}
 
+		if strings.HasPrefix(splittedDockerCommands[0], "@") {
+			multiContextBuiltin(splittedDockerCommands[0], splittedDockerCommands[1:])
+			invalidateSources()
+			continue
+		}
+
+		if runBuiltin(splittedDockerCommands) {
+			continue
+		}
+		warnUnsupported(splittedDockerCommands)
+
 		var ps *exec.Cmd
 
 		if splittedDockerCommands[0] == "clear" {
 			ps = exec.Command("clear")
 		} else {
-			ps = exec.Command("docker", splittedDockerCommands...)
+			ps = dockerCLI(splittedDockerCommands...)
 		}
 
 		res, err := ps.Output()
+		invalidateSources()
 
 		if err != nil {
 			fmt.Println(err)
@@ -0,0 +1,504 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/c-bata/go-prompt"
+)
+
+const (
+	mediaTypeManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	mediaTypeManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeOCIIndex     = "application/vnd.oci.image.index.v1+json"
+	mediaTypeOCIManifest  = "application/vnd.oci.image.manifest.v1+json"
+
+	// dockerHubRegistryHost serves the registry API of Docker Hub images
+	dockerHubRegistryHost = "registry-1.docker.io"
+
+	// manifestPreviewCount bounds the tags whose digest is looked up in the background for one completion
+	manifestPreviewCount = 10
+)
+
+// imageReference is a parsed `[host/]repository[:tag][@digest]` reference
+type imageReference struct {
+	Host       string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+func parseImageReference(reference string) imageReference {
+	ref := imageReference{Host: dockerHubRegistryHost}
+	if index := strings.Index(reference, "@"); index != -1 {
+		ref.Digest = reference[index+1:]
+		reference = reference[:index]
+	}
+	if index := strings.LastIndex(reference, ":"); index != -1 && !strings.Contains(reference[index:], "/") {
+		ref.Tag = reference[index+1:]
+		reference = reference[:index]
+	}
+	if isRegistryReference(reference) {
+		parts := strings.SplitN(reference, "/", 2)
+		ref.Host, reference = parts[0], parts[1]
+		if dockerHubRegistries[ref.Host] {
+			ref.Host = dockerHubRegistryHost
+		}
+	}
+	if ref.Host == dockerHubRegistryHost && !strings.Contains(reference, "/") {
+		reference = "library/" + reference
+	}
+	ref.Repository = reference
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = "latest"
+	}
+
+	return ref
+}
+
+// Reference returns the digest or tag the manifest is addressed with
+func (r imageReference) Reference() string {
+	if r.Digest != "" {
+		return r.Digest
+	}
+
+	return r.Tag
+}
+
+// Name returns the repository the way users type it
+func (r imageReference) Name() string {
+	if r.Host == dockerHubRegistryHost {
+		return strings.TrimPrefix(r.Repository, "library/")
+	}
+
+	return r.Host + "/" + r.Repository
+}
+
+func (r imageReference) String() string {
+	name := r.Name()
+	if r.Tag != "" {
+		name += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		name += "@" + r.Digest
+	}
+
+	return name
+}
+
+type registryPlatform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+func (p registryPlatform) String() string {
+	platform := p.OS + "/" + p.Architecture
+	if p.Variant != "" {
+		platform += "/" + p.Variant
+	}
+
+	return platform
+}
+
+type registryDescriptor struct {
+	MediaType string            `json:"mediaType"`
+	Digest    string            `json:"digest"`
+	Size      int64             `json:"size"`
+	Platform  *registryPlatform `json:"platform,omitempty"`
+}
+
+// registryManifest is an image manifest or a manifest list / index
+type registryManifest struct {
+	SchemaVersion int                  `json:"schemaVersion"`
+	MediaType     string               `json:"mediaType"`
+	Config        registryDescriptor   `json:"config"`
+	Layers        []registryDescriptor `json:"layers"`
+	Manifests     []registryDescriptor `json:"manifests"`
+}
+
+// manifestSummary is what is shown about a remote image before pulling it
+type manifestSummary struct {
+	Digest       string
+	MediaType    string
+	Size         int64
+	Layers       int
+	Platforms    []string
+	ConfigDigest string
+}
+
+// remoteImageConfig is the part of an image config blob shown by inspect-remote
+type remoteImageConfig struct {
+	Architecture string    `json:"architecture"`
+	OS           string    `json:"os"`
+	Created      time.Time `json:"created"`
+	Config       struct {
+		Env          []string            `json:"Env"`
+		Entrypoint   []string            `json:"Entrypoint"`
+		Cmd          []string            `json:"Cmd"`
+		ExposedPorts map[string]struct{} `json:"ExposedPorts"`
+		WorkingDir   string              `json:"WorkingDir"`
+		User         string              `json:"User"`
+		Labels       map[string]string   `json:"Labels"`
+	} `json:"config"`
+}
+
+// manifestAccept lists the manifest media types the shell understands
+var manifestAccept = http.Header{"Accept": {mediaTypeManifestList, mediaTypeOCIIndex, mediaTypeManifest, mediaTypeOCIManifest}}
+
+func (r *registryClient) manifest(repository string, reference string) (registryManifest, string, error) {
+	response, err := r.do(http.MethodGet, "/v2/"+repository+"/manifests/"+url.PathEscape(reference), manifestAccept, "repository:"+repository+":pull")
+	if err != nil {
+		return registryManifest{}, "", err
+	}
+
+	manifest := registryManifest{}
+	if err := decodeRegistryResponse(response, &manifest); err != nil {
+		return manifest, "", err
+	}
+	if manifest.MediaType == "" {
+		manifest.MediaType = response.Header.Get("Content-Type")
+	}
+
+	return manifest, response.Header.Get("Docker-Content-Digest"), nil
+}
+
+// Digest resolves a tag to the digest of its manifest with a HEAD request. Only manifest GETs count against
+// the Docker Hub pull quota, so this is how completion and outdated checks look up digests.
+func (r *registryClient) Digest(repository string, reference string) (string, error) {
+	response, err := r.do(http.MethodHead, "/v2/"+repository+"/manifests/"+url.PathEscape(reference), manifestAccept, "repository:"+repository+":pull")
+	if err != nil {
+		return "", err
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s: %s", response.Request.URL, response.Status)
+	}
+
+	digest := response.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		return "", fmt.Errorf("%s: no Docker-Content-Digest in the answer", response.Request.URL)
+	}
+
+	return digest, nil
+}
+
+// ManifestSummary resolves a tag or digest to its digest, size, layers and platforms.
+// Size and layers of a multi platform image are the ones of the platform of this machine, or the first one.
+func (r *registryClient) ManifestSummary(repository string, reference string) (manifestSummary, error) {
+	manifest, digest, err := r.manifest(repository, reference)
+	if err != nil {
+		return manifestSummary{}, err
+	}
+	summary := manifestSummary{Digest: digest, MediaType: manifest.MediaType}
+
+	if len(manifest.Manifests) > 0 {
+		selected, native := manifest.Manifests[0], false
+		for _, m := range manifest.Manifests {
+			if m.Platform == nil || m.Platform.OS == "unknown" {
+				continue
+			}
+			summary.Platforms = append(summary.Platforms, m.Platform.String())
+			if m.Platform.OS == runtime.GOOS && m.Platform.Architecture == runtime.GOARCH && !native {
+				selected, native = m, true
+			}
+		}
+
+		manifest, _, err = r.manifest(repository, selected.Digest)
+		if err != nil {
+			return summary, err
+		}
+	}
+
+	summary.ConfigDigest = manifest.Config.Digest
+	summary.Layers = len(manifest.Layers)
+	summary.Size = manifest.Config.Size
+	for _, layer := range manifest.Layers {
+		summary.Size += layer.Size
+	}
+
+	return summary, nil
+}
+
+// ImageConfig downloads the config blob of an image
+func (r *registryClient) ImageConfig(repository string, digest string) (remoteImageConfig, error) {
+	config := remoteImageConfig{}
+	response, err := r.do(http.MethodGet, "/v2/"+repository+"/blobs/"+digest, nil, "repository:"+repository+":pull")
+	if err != nil {
+		return config, err
+	}
+
+	return config, decodeRegistryResponse(response, &config)
+}
+
+func (s manifestSummary) Description() string {
+	details := []string{humanizeSize(s.Size), strconv.Itoa(s.Layers) + " layers"}
+	if len(s.Platforms) > 0 {
+		details = append(details, strings.Join(s.Platforms, " "))
+	}
+	digest := s.Digest
+	if len(digest) > 19 {
+		digest = digest[:19]
+	}
+	if digest != "" {
+		details = append(details, digest)
+	}
+
+	return strings.Join(details, ", ")
+}
+
+func humanizeSize(size int64) string {
+	units := []string{"B", "kB", "MB", "GB", "TB"}
+	value := float64(size)
+	unit := 0
+	for value >= 1000 && unit < len(units)-1 {
+		value /= 1000
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d%s", size, units[0])
+	}
+
+	return fmt.Sprintf("%.1f%s", value, units[unit])
+}
+
+func manifestCacheKey(ref imageReference) string {
+	return "manifest:" + ref.Host + "/" + ref.Repository + ":" + ref.Reference()
+}
+
+// fetchManifestSummary asks the mirrors and the registry for the current manifest of ref and caches it
+func fetchManifestSummary(ref imageReference) (manifestSummary, error) {
+	summary := manifestSummary{}
+	err := error(nil)
+	for _, endpoint := range registryEndpoints(ref.Host) {
+		if summary, err = endpoint.ManifestSummary(ref.Repository, ref.Reference()); err == nil {
+			completionCache.Store(manifestCacheKey(ref), summary)
+			return summary, nil
+		}
+	}
+
+	return summary, err
+}
+
+// digestFreshness is how long the digest of a remote tag is trusted before it is checked again
+const digestFreshness = 5 * time.Minute
+
+// digestCacheKey is the cache key of the digest of a remote tag
+func digestCacheKey(ref imageReference) string {
+	return "digest:" + ref.Host + "/" + ref.Repository + ":" + ref.Reference()
+}
+
+// fetchDigest asks the mirrors and the registry for the current digest of ref without downloading its manifest
+func fetchDigest(ref imageReference) (string, error) {
+	digest := ""
+	err := error(nil)
+	for _, endpoint := range registryEndpoints(ref.Host) {
+		if digest, err = endpoint.Digest(ref.Repository, ref.Reference()); err == nil {
+			return digest, nil
+		}
+	}
+
+	return digest, err
+}
+
+func remoteManifestSummary(ref imageReference) (manifestSummary, error) {
+	summary := manifestSummary{}
+	var loadErr error
+	found := completionCache.Fetch(manifestCacheKey(ref), 5*time.Minute, &summary, func() (interface{}, error) {
+		summary, err := fetchManifestSummary(ref)
+		loadErr = err
+		return summary, err
+	})
+	if !found {
+		return summary, loadErr
+	}
+
+	return summary, nil
+}
+
+// manifestPreviews are the manifests being fetched in the background for suggestion descriptions
+var manifestPreviews = struct {
+	sync.Mutex
+	loading map[string]bool
+}{loading: map[string]bool{}}
+
+// manifestPreview returns the cached description of a remote image and fetches it in the background when missing,
+// so the description shows up when the dropdown is refreshed
+func manifestPreview(ref imageReference) string {
+	summary := manifestSummary{}
+	key := manifestCacheKey(ref)
+	if completionCache.Peek(key, &summary) {
+		return summary.Description()
+	}
+
+	if ref.Host == dockerHubRegistryHost && !hubRateLimit.completionPulls() {
+		return ""
+	}
+
+	manifestPreviews.Lock()
+	defer manifestPreviews.Unlock()
+	if !manifestPreviews.loading[key] {
+		manifestPreviews.loading[key] = true
+		go func() {
+			remoteManifestSummary(ref)
+			manifestPreviews.Lock()
+			delete(manifestPreviews.loading, key)
+			manifestPreviews.Unlock()
+		}()
+	}
+
+	return ""
+}
+
+// digestPreview returns the digest of a remote image as description, looked up in the background when missing.
+// A manifest summary fetched before is shown instead.
+func digestPreview(ref imageReference) string {
+	summary := manifestSummary{}
+	if completionCache.Peek(manifestCacheKey(ref), &summary) {
+		return summary.Description()
+	}
+	if ref.Host == dockerHubRegistryHost && hubRateLimit.backoff() {
+		return ""
+	}
+
+	digest := ""
+	completionCache.FetchAsync(digestCacheKey(ref), digestFreshness, &digest, func() (interface{}, error) {
+		return fetchDigest(ref)
+	})
+	if len(digest) > 19 {
+		digest = digest[:19]
+	}
+
+	return digest
+}
+
+// tagSuggestion completes the tags of a `name:` being typed. The tag the user settled on, typed in full or the
+// only one left, is previewed with its manifest. The others only show their digest, which costs no pull.
+func tagSuggestion(word string) []prompt.Suggest {
+	index := strings.LastIndex(word, ":")
+	if index == -1 {
+		return []prompt.Suggest{}
+	}
+	ref := parseImageReference(word[:index])
+
+	tags := []string{}
+	if ref.Host == dockerHubRegistryHost {
+		tags = hubTags(ref.Repository)
+	} else {
+		tags = registryTags(ref.Host, ref.Repository)
+	}
+
+	suggestions := []prompt.Suggest{}
+	for _, tag := range tags {
+		if strings.HasPrefix(tag, word[index+1:]) {
+			suggestions = append(suggestions, prompt.Suggest{Text: ref.Name() + ":" + tag})
+		}
+	}
+	for i := range suggestions {
+		ref := parseImageReference(suggestions[i].Text)
+		switch {
+		case (ref.Tag == word[index+1:] || len(suggestions) == 1) && (ref.Host != dockerHubRegistryHost || hubRateLimit.completionPulls()):
+			suggestions[i].Description = manifestPreview(ref)
+		case i < manifestPreviewCount || ref.Tag == word[index+1:] || len(suggestions) == 1:
+			suggestions[i].Description = digestPreview(ref)
+		}
+	}
+
+	return suggestions
+}
+
+// hubTags lists the most recently updated tags of a Docker Hub repository
+func hubTags(repository string) []string {
+	tags := []string{}
+	completionCache.FetchAsync("hub-tags:"+repository, 5*time.Minute, &tags, func() (interface{}, error) {
+		page := struct {
+			Results []struct {
+				Name string `json:"name"`
+			} `json:"results"`
+		}{}
+		values := url.Values{"page_size": {strconv.Itoa(hubPageSize)}, "ordering": {"last_updated"}}
+		if err := dockerHub.get("/v2/repositories/"+repository+"/tags/", values, &page); err != nil {
+			return nil, err
+		}
+
+		names := []string{}
+		for _, tag := range page.Results {
+			names = append(names, tag.Name)
+		}
+		return names, nil
+	})
+
+	return tags
+}
+
+// inspectRemote prints the manifest summary and config of a remote image without pulling it
+func inspectRemote(reference string) error {
+	ref := parseImageReference(reference)
+	summary, err := remoteManifestSummary(ref)
+	if err != nil {
+		return err
+	}
+
+	config := remoteImageConfig{}
+	for _, endpoint := range registryEndpoints(ref.Host) {
+		if config, err = endpoint.ImageConfig(ref.Repository, summary.ConfigDigest); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Reference:    %s\n", ref)
+	fmt.Printf("Digest:       %s\n", summary.Digest)
+	fmt.Printf("Media type:   %s\n", summary.MediaType)
+	fmt.Printf("Size:         %s (%d layers)\n", humanizeSize(summary.Size), summary.Layers)
+	if len(summary.Platforms) > 0 {
+		fmt.Printf("Platforms:    %s\n", strings.Join(summary.Platforms, ", "))
+	}
+	fmt.Printf("Platform:     %s/%s\n", config.OS, config.Architecture)
+	if !config.Created.IsZero() {
+		fmt.Printf("Created:      %s\n", config.Created.Format(time.RFC3339))
+	}
+	fmt.Printf("Entrypoint:   %s\n", strings.Join(config.Config.Entrypoint, " "))
+	fmt.Printf("Cmd:          %s\n", strings.Join(config.Config.Cmd, " "))
+	if config.Config.WorkingDir != "" {
+		fmt.Printf("Working dir:  %s\n", config.Config.WorkingDir)
+	}
+	if config.Config.User != "" {
+		fmt.Printf("User:         %s\n", config.Config.User)
+	}
+
+	ports := []string{}
+	for port := range config.Config.ExposedPorts {
+		ports = append(ports, port)
+	}
+	sort.Strings(ports)
+	fmt.Printf("Ports:        %s\n", strings.Join(ports, ", "))
+
+	fmt.Println("Env:")
+	for _, env := range config.Config.Env {
+		fmt.Printf("  %s\n", env)
+	}
+
+	if len(config.Config.Labels) > 0 {
+		fmt.Println("Labels:")
+		keys := []string{}
+		for key := range config.Config.Labels {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Printf("  %s=%s\n", key, config.Config.Labels[key])
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/c-bata/go-prompt"
+)
+
+// allContexts is the target naming every context
+const allContexts = "all"
+
+// contextResult is how a command ended on one context
+type contextResult struct {
+	Name     string
+	ExitCode int
+	Err      error
+}
+
+// contextCommand runs the docker CLI against one context of a multi-daemon command
+var contextCommand = func(name string, args []string) *exec.Cmd {
+	return exec.Command("docker", append([]string{"--context", name}, args...)...)
+}
+
+// contextTargets turns a "@ctx1,ctx2" or "@all" prefix into context names, in the order given
+func contextTargets(prefix string) ([]string, error) {
+	contexts, err := loadDockerContexts()
+	if err != nil {
+		return nil, err
+	}
+	known := map[string]bool{}
+	for _, dockerCtx := range contexts {
+		known[dockerCtx.Name] = true
+	}
+
+	targets := []string{}
+	seen := map[string]bool{}
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			targets = append(targets, name)
+		}
+	}
+	for _, name := range strings.Split(strings.TrimPrefix(prefix, "@"), ",") {
+		switch {
+		case name == "":
+		case name == allContexts:
+			for _, dockerCtx := range contexts {
+				add(dockerCtx.Name)
+			}
+		case !known[name]:
+			return nil, fmt.Errorf("context %q does not exist", name)
+		default:
+			add(name)
+		}
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no context given, use @ctx1,ctx2 or @all")
+	}
+
+	return targets, nil
+}
+
+// runOnContexts runs a command on every context at once. Output lines are written as they come,
+// prefixed with the name of their context.
+func runOnContexts(targets []string, args []string, out io.Writer) []contextResult {
+	width := 0
+	for _, name := range targets {
+		if len(name) > width {
+			width = len(name)
+		}
+	}
+
+	lock := &sync.Mutex{}
+	results := make([]contextResult, len(targets))
+	wg := sync.WaitGroup{}
+	for i, name := range targets {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			results[i] = runOnContext(name, args, fmt.Sprintf("%-*s | ", width, name), out, lock)
+		}(i, name)
+	}
+	wg.Wait()
+
+	return results
+}
+
+func runOnContext(name string, args []string, prefix string, out io.Writer, lock *sync.Mutex) contextResult {
+	reader, writer := io.Pipe()
+	cmd := contextCommand(name, args)
+	cmd.Stdout, cmd.Stderr = writer, writer
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		scanner := bufio.NewScanner(reader)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			lock.Lock()
+			fmt.Fprintln(out, prefix+scanner.Text())
+			lock.Unlock()
+		}
+		// a line too long for the scanner must not block the command
+		io.Copy(ioutil.Discard, reader)
+	}()
+
+	err := cmd.Run()
+	writer.Close()
+	<-done
+
+	result := contextResult{Name: name}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		result.ExitCode = exitErr.ExitCode()
+	} else if err != nil {
+		result.ExitCode, result.Err = -1, err
+	}
+
+	return result
+}
+
+// printContextSummary lists the exit code of every context, failures are counted at the end
+func printContextSummary(results []contextResult, out io.Writer) {
+	writer := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "CONTEXT\tEXIT")
+	failed := 0
+	for _, result := range results {
+		status := strconv.Itoa(result.ExitCode)
+		if result.Err != nil {
+			status = result.Err.Error()
+		}
+		if result.ExitCode != 0 {
+			failed++
+		}
+		fmt.Fprintf(writer, "%s\t%s\n", result.Name, status)
+	}
+	writer.Flush()
+
+	if failed > 0 {
+		fmt.Fprintf(out, "%d of %d contexts failed\n", failed, len(results))
+	}
+}
+
+// multiContextBuiltin runs `@ctx1,ctx2 command` and `@all command`
+func multiContextBuiltin(prefix string, args []string) {
+	if activeEngine() != engineDocker {
+		fmt.Fprintln(os.Stderr, prefix+": running on several contexts needs the docker CLI")
+		return
+	}
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage:", shellCommands.Usage("@"))
+		return
+	}
+	if name, ok := builtinName(args); ok {
+		fmt.Fprintf(os.Stderr, "%s: %s is handled by the shell and only runs on the active context\n", prefix, name)
+		return
+	}
+
+	targets, err := contextTargets(prefix)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, prefix+":", err)
+		return
+	}
+
+	printContextSummary(runOnContexts(targets, args, os.Stdout), os.Stdout)
+}
+
+// documentOf returns a document of text with the cursor at the given rune position
+func documentOf(text string, cursor int) prompt.Document {
+	buffer := prompt.NewBuffer()
+	buffer.InsertText(text, false, true)
+	buffer.CursorLeft(len([]rune(text)) - cursor)
+
+	return *buffer.Document()
+}
+
+// withoutContextTargets drops the "@ctx1,ctx2" prefix so the rest of the line completes like a plain command
+func withoutContextTargets(d prompt.Document) prompt.Document {
+	index := strings.Index(d.Text, " ")
+	rest := strings.TrimLeft(d.Text[index:], " ")
+	cursor := len([]rune(d.TextBeforeCursor())) - (len([]rune(d.Text)) - len([]rune(rest)))
+	if cursor < 0 {
+		cursor = 0
+	}
+
+	return documentOf(rest, cursor)
+}
+
+// contextTargetSuggestion completes the last context of a "@ctx1,ctx2" prefix
+func contextTargetSuggestion(word string) []prompt.Suggest {
+	head := word[:strings.LastIndex(word, ",")+1]
+	if head == "" {
+		head = "@"
+	}
+
+	contexts, _ := loadDockerContexts()
+	suggestions := []prompt.Suggest{{Text: head + allContexts, Description: "Every context"}}
+	for _, dockerCtx := range contexts {
+		suggestions = append(suggestions, prompt.Suggest{Text: head + dockerCtx.Name, Description: dockerCtx.Host})
+	}
+
+	return prompt.FilterHasPrefix(suggestions, word, true)
+}
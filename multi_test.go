@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// useContexts points the docker configuration at a directory holding the given contexts
+func useContexts(t *testing.T, names ...string) func() {
+	dir, err := ioutil.TempDir("", "docker-shell-contexts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		writeDockerContext(t, dir, name, "tcp://"+name+":2376")
+	}
+
+	previous, set := os.LookupEnv("DOCKER_CONFIG")
+	os.Setenv("DOCKER_CONFIG", dir)
+	return func() {
+		if set {
+			os.Setenv("DOCKER_CONFIG", previous)
+		} else {
+			os.Unsetenv("DOCKER_CONFIG")
+		}
+		os.RemoveAll(dir)
+	}
+}
+
+// writeDockerContext stores a context for the docker endpoint host in the docker configuration directory dir
+func writeDockerContext(t *testing.T, dir string, name string, host string) {
+	meta := filepath.Join(dir, "contexts", "meta", contextDirName(name))
+	os.MkdirAll(meta, 0700)
+	content := `{"Name":"` + name + `","Endpoints":{"docker":{"Host":"` + host + `"}}}`
+	if err := ioutil.WriteFile(filepath.Join(meta, "meta.json"), []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestContextTargets(t *testing.T) {
+	defer useContexts(t, "staging", "production")()
+
+	for prefix, want := range map[string]string{
+		"@all":                        "default,production,staging",
+		"@staging,production,staging": "staging,production",
+		"@production,":                "production",
+		"@":                           "",
+		"@staging,unknown":            "",
+	} {
+		targets, err := contextTargets(prefix)
+		if got := strings.Join(targets, ","); got != want || (err == nil) != (want != "") {
+			t.Errorf("%s: got %q (%v), want %q", prefix, got, err, want)
+		}
+	}
+}
+
+func TestRunOnContexts(t *testing.T) {
+	previous := contextCommand
+	defer func() { contextCommand = previous }()
+	contextCommand = func(name string, args []string) *exec.Cmd {
+		code := "0"
+		if name == "production" {
+			code = "3"
+		}
+		return exec.Command("sh", "-c", `echo "$1 on $0"; echo warning >&2; exit $2`, name, strings.Join(args, " "), code)
+	}
+
+	out := &bytes.Buffer{}
+	results := runOnContexts([]string{"staging", "production"}, []string{"ps", "-a"}, out)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	sort.Strings(lines)
+	want := []string{
+		"production | ps -a on production",
+		"production | warning",
+		"staging    | ps -a on staging",
+		"staging    | warning",
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+
+	if results[0].ExitCode != 0 || results[1].ExitCode != 3 {
+		t.Errorf("unexpected results %+v", results)
+	}
+	summary := &bytes.Buffer{}
+	printContextSummary(results, summary)
+	if !strings.Contains(summary.String(), "1 of 2 contexts failed") {
+		t.Errorf("unexpected summary:\n%s", summary)
+	}
+}
+
+func TestContextTargetCompletion(t *testing.T) {
+	defer useContexts(t, "staging", "production")()
+
+	suggestions := contextTargetSuggestion("@staging,pr")
+	if len(suggestions) != 1 || suggestions[0].Text != "@staging,production" {
+		t.Errorf("unexpected suggestions %v", suggestions)
+	}
+
+	d := withoutContextTargets(documentOf("@all image prune", len("@all image")))
+	if d.Text != "image prune" || d.TextBeforeCursor() != "image" {
+		t.Errorf("got %q with %q before the cursor", d.Text, d.TextBeforeCursor())
+	}
+}
+
+// builtins only run on the active context, `@all context use x` would rewrite config.json once per context
+func TestMultiContextBuiltinRejectsBuiltins(t *testing.T) {
+	defer useContexts(t, "staging", "production")()
+	previous := contextCommand
+	defer func() { contextCommand = previous }()
+	ran := []string{}
+	lock := sync.Mutex{}
+	contextCommand = func(name string, args []string) *exec.Cmd {
+		lock.Lock()
+		defer lock.Unlock()
+		ran = append(ran, name+": "+strings.Join(args, " "))
+		return exec.Command("true")
+	}
+
+	for _, args := range [][]string{
+		{"context", "use", "staging"},
+		{"pin", "nginx"},
+		{"about"},
+	} {
+		ran = ran[:0]
+		captureStdout(t, func() { multiContextBuiltin("@all", args) })
+		if len(ran) != 0 {
+			t.Errorf("%q ran on %v", strings.Join(args, " "), ran)
+		}
+	}
+
+	ran = ran[:0]
+	captureStdout(t, func() { multiContextBuiltin("@all", []string{"context", "ls"}) })
+	if len(ran) != 3 {
+		t.Errorf("`context ls` ran on %v, want every context", ran)
+	}
+}
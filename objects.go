@@ -0,0 +1,398 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	docker "docker.io/go-docker"
+	"docker.io/go-docker/api/types"
+	"docker.io/go-docker/api/types/events"
+	"docker.io/go-docker/api/types/filters"
+	volumetypes "docker.io/go-docker/api/types/volume"
+	"github.com/c-bata/go-prompt"
+)
+
+// containerEventActions are the container events which change what completion shows
+var containerEventActions = map[string]bool{
+	"create": true, "start": true, "restart": true, "die": true, "stop": true, "kill": true,
+	"pause": true, "unpause": true, "rename": true, "update": true, "destroy": true,
+}
+
+// objectModel mirrors the containers, images, networks and volumes of the daemon. It is loaded once and kept up
+// to date from the event stream, completers read it instead of listing objects on every keystroke.
+type objectModel struct {
+	sync.RWMutex
+	// client is the daemon the model follows, it doesn't change
+	client     *docker.Client
+	synced     bool
+	containers map[string]types.Container
+	images     map[string]types.ImageSummary
+	networks   map[string]types.NetworkResource
+	volumes    map[string]types.Volume
+}
+
+// objects returns the model of the daemon the shell is connected to
+func objects() *objectModel {
+	return currentConnection().objects
+}
+
+// watch keeps the model in sync until ctx is done. The event stream is subscribed before the full resync
+// so no change is missed, and both are started again after the connection to the daemon is lost.
+func (m *objectModel) watch(ctx context.Context) {
+	backoff := time.Second
+	for ctx.Err() == nil {
+		args := filters.NewArgs()
+		for _, eventType := range []string{events.ContainerEventType, events.ImageEventType, events.NetworkEventType, events.VolumeEventType} {
+			args.Add("type", eventType)
+		}
+		streamCtx, cancel := context.WithCancel(ctx)
+		messages, errs := m.client.Events(streamCtx, types.EventsOptions{Filters: args})
+
+		if err := m.resync(streamCtx); err == nil {
+			backoff = time.Second
+			completionEngine.refresh()
+			m.follow(ctx, messages, errs)
+		}
+		cancel()
+
+		m.Lock()
+		m.synced = false
+		m.Unlock()
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(backoff):
+		}
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+	}
+}
+
+// follow applies the events until the stream ends or an event can't be applied, the caller resyncs then
+func (m *objectModel) follow(ctx context.Context, messages <-chan events.Message, errs <-chan error) {
+	for {
+		select {
+		case message, ok := <-messages:
+			if !ok {
+				return
+			}
+			if m.apply(ctx, message) != nil {
+				return
+			}
+		case <-errs:
+			return
+		}
+	}
+}
+
+// resync replaces the whole model with fresh listings
+func (m *objectModel) resync(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	containerList, err := m.client.ContainerList(ctx, types.ContainerListOptions{All: true})
+	if err != nil {
+		return err
+	}
+	imageList, err := m.client.ImageList(ctx, types.ImageListOptions{})
+	if err != nil {
+		return err
+	}
+	networkList, err := m.client.NetworkList(ctx, types.NetworkListOptions{})
+	if err != nil {
+		return err
+	}
+	volumeList, err := m.client.VolumeList(ctx, filters.NewArgs())
+	if err != nil {
+		return err
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	m.containers = map[string]types.Container{}
+	for _, container := range containerList {
+		m.containers[container.ID] = container
+	}
+	m.images = map[string]types.ImageSummary{}
+	for _, image := range imageList {
+		m.images[image.ID] = image
+	}
+	m.networks = map[string]types.NetworkResource{}
+	for _, network := range networkList {
+		m.networks[network.ID] = network
+	}
+	m.volumes = map[string]types.Volume{}
+	for _, volume := range volumeList.Volumes {
+		if volume != nil {
+			m.volumes[volume.Name] = *volume
+		}
+	}
+	m.synced = true
+
+	return nil
+}
+
+// apply reloads the single object an event is about, an object which can't be found anymore is removed.
+// A panic, e.g. on a malformed event, is returned as an error, the model may be inconsistent then.
+func (m *objectModel) apply(ctx context.Context, message events.Message) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("panic: %v", recovered)
+		}
+	}()
+	ctx, cancel := context.WithTimeout(ctx, sourceDeadline)
+	defer cancel()
+
+	id := message.Actor.ID
+	switch message.Type {
+	case events.ContainerEventType:
+		if !containerEventActions[message.Action] {
+			return nil
+		}
+		args := filters.NewArgs()
+		args.Add("id", id)
+		containers, err := m.client.ContainerList(ctx, types.ContainerListOptions{All: true, Filters: args})
+		if err != nil {
+			return err
+		}
+		m.update(func() {
+			delete(m.containers, id)
+			for _, container := range containers {
+				m.containers[container.ID] = container
+			}
+		})
+
+	case events.ImageEventType:
+		inspection, _, err := m.client.ImageInspectWithRaw(ctx, id)
+		if err != nil && !docker.IsErrNotFound(err) {
+			return err
+		}
+		m.update(func() {
+			if err != nil {
+				delete(m.images, id)
+			} else {
+				m.images[inspection.ID] = imageSummaryOf(inspection, m.images[inspection.ID])
+			}
+		})
+
+	case events.NetworkEventType:
+		if message.Action != "create" && message.Action != "destroy" {
+			return nil
+		}
+		args := filters.NewArgs()
+		args.Add("id", id)
+		networks, err := m.client.NetworkList(ctx, types.NetworkListOptions{Filters: args})
+		if err != nil {
+			return err
+		}
+		m.update(func() {
+			delete(m.networks, id)
+			for _, network := range networks {
+				m.networks[network.ID] = network
+			}
+		})
+
+	case events.VolumeEventType:
+		if message.Action != "create" && message.Action != "destroy" {
+			return nil
+		}
+		args := filters.NewArgs()
+		args.Add("name", id)
+		volumes, err := m.client.VolumeList(ctx, args)
+		if err != nil {
+			return err
+		}
+		m.update(func() {
+			delete(m.volumes, id)
+			for _, volume := range volumes.Volumes {
+				if volume != nil && volume.Name == id {
+					m.volumes[volume.Name] = *volume
+				}
+			}
+		})
+
+	default:
+		return nil
+	}
+
+	completionEngine.refresh()
+	return nil
+}
+
+// update changes the model under its lock, which is released when change panics
+func (m *objectModel) update(change func()) {
+	m.Lock()
+	defer m.Unlock()
+	change()
+}
+
+// imageSummaryOf converts an inspection into the summary image listings return
+func imageSummaryOf(inspection types.ImageInspect, previous types.ImageSummary) types.ImageSummary {
+	summary := previous
+	summary.ID = inspection.ID
+	summary.RepoTags = inspection.RepoTags
+	summary.RepoDigests = inspection.RepoDigests
+	summary.Size = inspection.Size
+	if created, err := time.Parse(time.RFC3339Nano, inspection.Created); err == nil {
+		summary.Created = created.Unix()
+	}
+
+	return summary
+}
+
+// Containers returns every container, most recently created first
+func (m *objectModel) Containers() ([]types.Container, bool) {
+	m.RLock()
+	defer m.RUnlock()
+	if !m.synced {
+		return nil, false
+	}
+
+	containers := make([]types.Container, 0, len(m.containers))
+	for _, container := range m.containers {
+		containers = append(containers, container)
+	}
+	sort.Slice(containers, func(i, j int) bool { return containers[i].Created > containers[j].Created })
+
+	return containers, true
+}
+
+// Images returns the top level images, most recently created first
+func (m *objectModel) Images() ([]types.ImageSummary, bool) {
+	m.RLock()
+	defer m.RUnlock()
+	if !m.synced {
+		return nil, false
+	}
+
+	images := make([]types.ImageSummary, 0, len(m.images))
+	for _, image := range m.images {
+		images = append(images, image)
+	}
+	sort.Slice(images, func(i, j int) bool { return images[i].Created > images[j].Created })
+
+	return images, true
+}
+
+// Networks returns the networks sorted by name
+func (m *objectModel) Networks() ([]types.NetworkResource, bool) {
+	m.RLock()
+	defer m.RUnlock()
+	if !m.synced {
+		return nil, false
+	}
+
+	networks := make([]types.NetworkResource, 0, len(m.networks))
+	for _, network := range m.networks {
+		networks = append(networks, network)
+	}
+	sort.Slice(networks, func(i, j int) bool { return networks[i].Name < networks[j].Name })
+
+	return networks, true
+}
+
+// Volumes returns the volumes sorted by name
+func (m *objectModel) Volumes() ([]types.Volume, bool) {
+	m.RLock()
+	defer m.RUnlock()
+	if !m.synced {
+		return nil, false
+	}
+
+	volumes := make([]types.Volume, 0, len(m.volumes))
+	for _, volume := range m.volumes {
+		volumes = append(volumes, volume)
+	}
+	sort.Slice(volumes, func(i, j int) bool { return volumes[i].Name < volumes[j].Name })
+
+	return volumes, true
+}
+
+// containerList reads the model, or the daemon in the background while the model isn't synced
+func containerList() ([]types.Container, error) {
+	if containers, ok := objects().Containers(); ok {
+		return containers, nil
+	}
+
+	containers := []types.Container{}
+	fetchAsync("containers", 5*time.Second, sourceDeadline, &containers, func(ctx context.Context, client *docker.Client) (interface{}, error) {
+		return client.ContainerList(ctx, types.ContainerListOptions{All: true})
+	})
+	return containers, sourceError("containers")
+}
+
+// imageList reads the model, or the daemon in the background while the model isn't synced
+func imageList() ([]types.ImageSummary, error) {
+	if images, ok := objects().Images(); ok {
+		return images, nil
+	}
+
+	images := []types.ImageSummary{}
+	fetchAsync("images", 10*time.Second, sourceDeadline, &images, func(ctx context.Context, client *docker.Client) (interface{}, error) {
+		return client.ImageList(ctx, types.ImageListOptions{})
+	})
+	return images, sourceError("images")
+}
+
+func networkSuggestion() ([]prompt.Suggest, error) {
+	networks, ok := objects().Networks()
+	var err error
+	if !ok {
+		fetchAsync("networks", 10*time.Second, sourceDeadline, &networks, func(ctx context.Context, client *docker.Client) (interface{}, error) {
+			return client.NetworkList(ctx, types.NetworkListOptions{})
+		})
+		err = sourceError("networks")
+	}
+
+	suggestions := []prompt.Suggest{}
+	for _, network := range networks {
+		suggestions = append(suggestions, prompt.Suggest{Text: network.Name, Description: network.Driver + ", " + network.Scope})
+	}
+
+	return suggestions, err
+}
+
+func volumeSuggestion() ([]prompt.Suggest, error) {
+	volumes, ok := objects().Volumes()
+	var err error
+	if !ok {
+		list := volumetypes.VolumesListOKBody{}
+		fetchAsync("volumes", 10*time.Second, sourceDeadline, &list, func(ctx context.Context, client *docker.Client) (interface{}, error) {
+			return client.VolumeList(ctx, filters.NewArgs())
+		})
+		for _, volume := range list.Volumes {
+			if volume != nil {
+				volumes = append(volumes, *volume)
+			}
+		}
+		err = sourceError("volumes")
+	}
+
+	suggestions := []prompt.Suggest{}
+	for _, volume := range volumes {
+		description := volume.Driver
+		if project := volume.Labels[composeProjectLabel]; project != "" {
+			description += ", compose project " + project
+		}
+		suggestions = append(suggestions, prompt.Suggest{Text: volume.Name, Description: description})
+	}
+
+	return suggestions, err
+}
+
+// composeContainerFilter keeps the containers of a compose project, or of any project when project is empty
+func composeContainerFilter(containers []types.Container, project string) []types.Container {
+	filtered := []types.Container{}
+	for _, container := range containers {
+		name, ok := container.Labels[composeProjectLabel]
+		if ok && (project == "" || name == project) {
+			filtered = append(filtered, container)
+		}
+	}
+
+	return filtered
+}
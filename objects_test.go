@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	docker "docker.io/go-docker"
+	"docker.io/go-docker/api/types/events"
+)
+
+// an event which can't be applied is reported so the model resyncs, and leaves the model unlocked
+func TestObjectModelApplyReportsPanics(t *testing.T) {
+	defer useFakeDaemon(t, fakeDaemonSize{Containers: 1})()
+
+	// a model without maps panics when it stores the container
+	model := &objectModel{client: dockerClient()}
+	err := model.apply(context.Background(), events.Message{Type: events.ContainerEventType, Action: "start", Actor: events.Actor{ID: fakeID('c', 0)}})
+	if err == nil {
+		t.Fatal("the panic wasn't reported")
+	}
+
+	locked := make(chan struct{})
+	go func() {
+		model.Lock()
+		model.Unlock()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Fatal("the model is still locked after the panic")
+	}
+}
+
+// a failed lookup is reported so the model resyncs, only an image the daemon doesn't know anymore is dropped
+func TestObjectModelApplyReportsFailedLookups(t *testing.T) {
+	defer useFakeDaemon(t, fakeDaemonSize{Containers: 1, Images: 2, Networks: 1, Volumes: 1})()
+	model := &objectModel{client: dockerClient()}
+	if err := model.resync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "daemon is restarting", http.StatusInternalServerError)
+	}))
+	defer broken.Close()
+	brokenClient, err := docker.NewClient("tcp://"+broken.Listener.Addr().String(), "1.35", broken.Client(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	healthy := model.client
+	model.client = brokenClient
+
+	image := "sha256:" + fakeID('i', 0)
+	for _, message := range []events.Message{
+		{Type: events.ContainerEventType, Action: "start", Actor: events.Actor{ID: fakeID('c', 0)}},
+		{Type: events.ImageEventType, Action: "tag", Actor: events.Actor{ID: image}},
+		{Type: events.NetworkEventType, Action: "destroy", Actor: events.Actor{ID: fakeID('n', 0)}},
+		{Type: events.VolumeEventType, Action: "destroy", Actor: events.Actor{ID: "volume_0"}},
+	} {
+		if err := model.apply(context.Background(), message); err == nil {
+			t.Errorf("%s %s: the failed lookup wasn't reported", message.Type, message.Action)
+		}
+	}
+	if _, ok := model.images[image]; !ok {
+		t.Error("the image was dropped after a failed lookup")
+	}
+
+	model.client = healthy
+	deleted := "sha256:" + fakeID('i', 99)
+	model.images[deleted] = model.images[image]
+	if err := model.apply(context.Background(), events.Message{Type: events.ImageEventType, Action: "delete", Actor: events.Actor{ID: deleted}}); err != nil {
+		t.Errorf("the deleted image wasn't applied: %v", err)
+	}
+	if _, ok := model.images[deleted]; ok {
+		t.Error("the deleted image is still in the model")
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"docker.io/go-docker/api/types"
+)
+
+// outdatedWorkers bounds the registries queried at once by outdated
+const outdatedWorkers = 4
+
+// outdatedImage is a local tag whose digest no longer matches the registry
+type outdatedImage struct {
+	Reference    string
+	LocalDigest  string
+	RemoteDigest string
+	Created      time.Time
+}
+
+// findOutdatedImages checks the local images with checkOutdated
+func findOutdatedImages() ([]outdatedImage, []error) {
+	images, err := dockerClient().ImageList(context.Background(), types.ImageListOptions{})
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	return checkOutdated(images)
+}
+
+// checkOutdated compares the digest every tag was pulled with to the current digest of the tag in its registry,
+// which is asked with a HEAD request so no pull is counted. Images which were built locally have no digest and are skipped.
+func checkOutdated(images []types.ImageSummary) ([]outdatedImage, []error) {
+	type check struct {
+		reference string
+		digests   []string
+		created   time.Time
+	}
+	checks := make(chan check)
+	go func() {
+		defer close(checks)
+		for _, image := range images {
+			for _, repoTag := range image.RepoTags {
+				if repoTag == "<none>:<none>" {
+					continue
+				}
+				digests := []string{}
+				for _, repoDigest := range image.RepoDigests {
+					parts := strings.SplitN(repoDigest, "@", 2)
+					if len(parts) == 2 && localRepository(parts[0]) == localRepository(repoTag) {
+						digests = append(digests, parts[1])
+					}
+				}
+				if len(digests) > 0 {
+					checks <- check{reference: repoTag, digests: digests, created: time.Unix(image.Created, 0)}
+				}
+			}
+		}
+	}()
+
+	lock := sync.Mutex{}
+	outdated := []outdatedImage{}
+	errors := []error{}
+	wg := sync.WaitGroup{}
+	for i := 0; i < outdatedWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range checks {
+				digest, err := fetchDigest(parseImageReference(c.reference))
+				lock.Lock()
+				switch {
+				case err != nil:
+					errors = append(errors, fmt.Errorf("%s: %v", c.reference, err))
+				case digest != "" && !hasDigest(c.digests, digest):
+					outdated = append(outdated, outdatedImage{
+						Reference:    c.reference,
+						LocalDigest:  c.digests[0],
+						RemoteDigest: digest,
+						Created:      c.created,
+					})
+				}
+				lock.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	sort.Slice(outdated, func(i, j int) bool { return outdated[i].Created.Before(outdated[j].Created) })
+	return outdated, errors
+}
+
+// hasDigest tells whether digest is one of digests, digests are compared exactly
+func hasDigest(digests []string, digest string) bool {
+	for _, d := range digests {
+		if d == digest {
+			return true
+		}
+	}
+
+	return false
+}
+
+// humanizeAge formats how long ago t was in the largest fitting unit
+func humanizeAge(t time.Time) string {
+	age := time.Since(t)
+	switch {
+	case age >= 365*24*time.Hour:
+		return fmt.Sprintf("%d years", int(age.Hours()/24/365))
+	case age >= 30*24*time.Hour:
+		return fmt.Sprintf("%d months", int(age.Hours()/24/30))
+	case age >= 7*24*time.Hour:
+		return fmt.Sprintf("%d weeks", int(age.Hours()/24/7))
+	case age >= 24*time.Hour:
+		return fmt.Sprintf("%d days", int(age.Hours()/24))
+	case age >= time.Hour:
+		return fmt.Sprintf("%d hours", int(age.Hours()))
+	default:
+		return fmt.Sprintf("%d minutes", int(age.Minutes()))
+	}
+}
+
+func shortDigest(digest string) string {
+	if len(digest) > 19 {
+		return digest[:19]
+	}
+
+	return digest
+}
+
+func outdatedBuiltin(args []string) {
+	pull := false
+	for _, arg := range args {
+		if arg != "--pull" {
+			fmt.Fprintln(os.Stderr, "usage:", shellCommands.Usage("outdated"))
+			return
+		}
+		pull = true
+	}
+
+	outdated, errors := findOutdatedImages()
+	for _, err := range errors {
+		fmt.Fprintln(os.Stderr, "outdated:", err)
+	}
+	if len(outdated) == 0 {
+		fmt.Println("Every pulled image is up to date")
+		return
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "IMAGE\tAGE\tLOCAL\tREGISTRY")
+	for _, image := range outdated {
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", image.Reference, humanizeAge(image.Created), shortDigest(image.LocalDigest), shortDigest(image.RemoteDigest))
+	}
+	writer.Flush()
+
+	if !pull {
+		return
+	}
+	for _, image := range outdated {
+		cmd := dockerCLI("pull", image.Reference)
+		cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+		if err := cmd.Run(); err != nil {
+			fmt.Fprintf(os.Stderr, "outdated: pulling %s: %v\n", image.Reference, err)
+		}
+	}
+}
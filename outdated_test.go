@@ -0,0 +1,54 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"docker.io/go-docker/api/types"
+)
+
+func TestCheckOutdated(t *testing.T) {
+	current := "sha256:" + strings.Repeat("2", 64)
+	registry := newFakeRegistry(map[string]string{
+		"team/api:v1":     current,
+		"team/worker:v1":  current,
+		"team/private:v1": current,
+	})
+	registry.private["team/private"] = true
+	host, restore := useFakeRegistry(t, registry)
+	defer restore()
+
+	old := "sha256:" + strings.Repeat("1", 64)
+	image := func(repository string, digest string) types.ImageSummary {
+		return types.ImageSummary{
+			RepoTags:    []string{host + "/" + repository + ":v1"},
+			RepoDigests: []string{host + "/" + repository + "@" + digest},
+		}
+	}
+	outdated, errors := checkOutdated([]types.ImageSummary{
+		image("team/api", current),
+		image("team/worker", old),
+		image("team/private", old),
+		// built locally, there is nothing to compare
+		{RepoTags: []string{host + "/team/local:v1"}},
+		// a digest differing in a trailing slash only is a different digest
+		image("team/api", current+"/"),
+	})
+
+	local := map[string]bool{}
+	for _, image := range outdated {
+		if image.RemoteDigest != current {
+			t.Errorf("%s is compared to %s", image.Reference, image.RemoteDigest)
+		}
+		local[image.Reference+"@"+image.LocalDigest] = true
+	}
+	if len(outdated) != 2 || !local[host+"/team/worker:v1@"+old] || !local[host+"/team/api:v1@"+current+"/"] {
+		t.Errorf("outdated images are %+v", outdated)
+	}
+	if len(errors) != 1 || !strings.Contains(errors[0].Error(), "team/private") {
+		t.Errorf("errors are %v, want the private repository to ask for credentials", errors)
+	}
+	if registry.count("GET manifest") != 0 || registry.count("HEAD manifest") != 3 {
+		t.Errorf("outdated made %d GET and %d HEAD manifest requests", registry.count("GET manifest"), registry.count("HEAD manifest"))
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	docker "docker.io/go-docker"
+	"github.com/c-bata/go-prompt"
+)
+
+// localDigest returns the digest a local image was pulled with, if it has been pulled from a registry
+func localDigest(ctx context.Context, client *docker.Client, reference string) string {
+	inspection, _, err := client.ImageInspectWithRaw(ctx, reference)
+	if err != nil {
+		return ""
+	}
+	for _, repoDigest := range inspection.RepoDigests {
+		parts := strings.SplitN(repoDigest, "@", 2)
+		if len(parts) == 2 && localRepository(parts[0]) == localRepository(reference) {
+			return parts[1]
+		}
+	}
+
+	return ""
+}
+
+// pinnedReference returns `name:tag@digest` for a reference, the digest of the local image wins over the registry one
+func pinnedReference(reference string) (string, string, error) {
+	if strings.Contains(reference, "@") {
+		return reference, "already pinned", nil
+	}
+
+	ref := parseImageReference(reference)
+	name := reference
+	if !strings.HasSuffix(name, ":"+ref.Tag) {
+		name += ":" + ref.Tag
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if digest := localDigest(ctx, dockerClient(), name); digest != "" {
+		return name + "@" + digest, "local", nil
+	}
+
+	// the digest is asked with a HEAD request, which doesn't count against the Docker Hub pull quota
+	if ref.Host == dockerHubRegistryHost && hubRateLimit.backoff() {
+		return "", "", errHubBackoff
+	}
+	digest, err := fetchDigest(ref)
+	if err != nil {
+		return "", "", err
+	}
+	completionCache.Store(digestCacheKey(ref), digest)
+
+	return name + "@" + digest, ref.Host, nil
+}
+
+// pinSuggestion completes `name[:tag]@` with the digest of the local image or, once fetched in the background,
+// of the registry
+func pinSuggestion(word string) []prompt.Suggest {
+	index := strings.Index(word, "@")
+	if index == -1 {
+		return []prompt.Suggest{}
+	}
+	name := word[:index]
+	if name == "" {
+		return []prompt.Suggest{}
+	}
+
+	digest := ""
+	loaded := fetchAsync("local-digest:"+name, 10*time.Second, sourceDeadline, &digest, func(ctx context.Context, client *docker.Client) (interface{}, error) {
+		return localDigest(ctx, client, name), nil
+	})
+	if !loaded {
+		return []prompt.Suggest{}
+	}
+	if digest != "" {
+		return []prompt.Suggest{{Text: name + "@" + digest, Description: "Pinned to the local image"}}
+	}
+
+	ref := parseImageReference(name)
+	if ref.Host == dockerHubRegistryHost && hubRateLimit.backoff() {
+		return []prompt.Suggest{}
+	}
+	key := digestCacheKey(ref)
+	if !completionCache.FetchAsync(key, digestFreshness, &digest, func() (interface{}, error) {
+		return fetchDigest(ref)
+	}) {
+		return []prompt.Suggest{}
+	}
+	// a stale digest is being checked again in the background, the tag may have moved since
+	age, _ := completionCache.Age(key)
+	if digest == "" || age >= digestFreshness {
+		return []prompt.Suggest{}
+	}
+
+	return []prompt.Suggest{{Text: name + "@" + digest, Description: "Pinned to " + ref.Host + ", checked " + age.Round(time.Second).String() + " ago"}}
+}
+
+// pinnableCommands are the commands whose image argument F2 pins
+var pinnableCommands = map[string]bool{"run": true, "pull": true, "pin": true, "inspect-remote": true}
+
+// fieldSpans returns the rune offsets where the space separated fields of text start and end
+func fieldSpans(text string) [][2]int {
+	spans := [][2]int{}
+	start := -1
+	runes := []rune(text)
+	for i, r := range runes {
+		if r == ' ' {
+			if start != -1 {
+				spans = append(spans, [2]int{start, i})
+				start = -1
+			}
+		} else if start == -1 {
+			start = i
+		}
+	}
+	if start != -1 {
+		spans = append(spans, [2]int{start, len(runes)})
+	}
+
+	return spans
+}
+
+// imageSpan returns the rune offsets of the image argument of the command line, found with the parsing
+// completion uses
+func imageSpan(d prompt.Document) ([2]int, bool) {
+	matched := d
+	if strings.HasPrefix(d.Text, "@") {
+		matched = withoutContextTargets(d)
+	}
+	command, ok := matchCommand(matched)
+	if !ok || !pinnableCommands[command] {
+		return [2]int{}, false
+	}
+
+	runes := []rune(d.Text)
+	spans := fieldSpans(d.Text)
+	name := command[strings.LastIndex(command, " ")+1:]
+	for i, span := range spans {
+		if string(runes[span[0]:span[1]]) != name {
+			continue
+		}
+		args := []string{}
+		for _, arg := range spans[i+1:] {
+			args = append(args, string(runes[arg[0]:arg[1]]))
+		}
+		if index, _ := imageArgument(command, args); index != -1 {
+			return spans[i+1+index], true
+		}
+		break
+	}
+
+	return [2]int{}, false
+}
+
+// pinKeyBindWait is how long F2 waits for a pin before leaving the lookup in the background
+const pinKeyBindWait = 100 * time.Millisecond
+
+// pinLookup is a pin looked up for F2, done is closed once pinned or err is set
+type pinLookup struct {
+	done    chan struct{}
+	started time.Time
+	pinned  string
+	err     error
+}
+
+// pinLookups are the pins F2 looks up off the input goroutine, by image argument. A lookup which isn't done in
+// pinKeyBindWait is picked up by the next F2 on the same image, unless the digest may have moved since.
+var pinLookups = struct {
+	sync.Mutex
+	lookups map[string]*pinLookup
+}{lookups: map[string]*pinLookup{}}
+
+// lookupPin returns the lookup of the pinned form of reference, starting it unless it is running already
+func lookupPin(reference string) *pinLookup {
+	pinLookups.Lock()
+	defer pinLookups.Unlock()
+
+	if lookup, ok := pinLookups.lookups[reference]; ok && time.Since(lookup.started) < digestFreshness {
+		return lookup
+	}
+	lookup := &pinLookup{done: make(chan struct{}), started: time.Now()}
+	pinLookups.lookups[reference] = lookup
+	go func() {
+		lookup.pinned, _, lookup.err = pinnedReference(reference)
+		close(lookup.done)
+	}()
+
+	return lookup
+}
+
+// forgetPin drops a lookup once F2 used it, the next F2 looks the reference up again
+func forgetPin(reference string, lookup *pinLookup) {
+	pinLookups.Lock()
+	defer pinLookups.Unlock()
+
+	if pinLookups.lookups[reference] == lookup {
+		delete(pinLookups.lookups, reference)
+	}
+}
+
+// pinKeyBind rewrites the image argument of the command line to its pinned form
+func pinKeyBind(b *prompt.Buffer) {
+	d := *b.Document()
+	span, ok := imageSpan(d)
+	if !ok {
+		return
+	}
+	word := string([]rune(d.Text)[span[0]:span[1]])
+	if strings.Contains(word, "@") {
+		return
+	}
+
+	lookup := lookupPin(word)
+	select {
+	case <-lookup.done:
+	case <-time.After(pinKeyBindWait):
+		// the terminal is in raw mode while the prompt is active
+		fmt.Print("\r\npin: looking up the digest of " + word + ", press F2 again to pin it\r\n")
+		return
+	}
+	forgetPin(word, lookup)
+	if lookup.err != nil {
+		fmt.Print("\r\npin: " + lookup.err.Error() + "\r\n")
+		return
+	}
+
+	cursor := len([]rune(d.TextBeforeCursor()))
+	if cursor < span[1] {
+		b.CursorRight(span[1] - cursor)
+	} else {
+		b.CursorLeft(cursor - span[1])
+	}
+	b.DeleteBeforeCursor(span[1] - span[0])
+	b.InsertText(lookup.pinned, false, true)
+	// the cursor stays where it was when it was after the image
+	if cursor > span[1] {
+		b.CursorRight(cursor - span[1])
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/c-bata/go-prompt"
+	"github.com/patrickmn/go-cache"
+)
+
+func TestPinSuggestionRefusesStaleDigests(t *testing.T) {
+	defer useFakeDaemon(t, fakeDaemonSize{})()
+	registry := newFakeRegistry(map[string]string{
+		"team/api:v1": "sha256:1111111111111111111111111111111111111111111111111111111111111111",
+	})
+	host, restore := useFakeRegistry(t, registry)
+	defer restore()
+
+	name := host + "/team/api:v1"
+	ref := parseImageReference(name)
+	raw, _ := json.Marshal("sha256:0000000000000000000000000000000000000000000000000000000000000000")
+	completionCache.memory.Set(digestCacheKey(ref), cacheEntry{Key: digestCacheKey(ref), Stored: time.Now().Add(-time.Hour), Value: raw}, cache.NoExpiration)
+
+	// polling faster than the debounce would keep postponing the local lookup
+	pinSuggestion(name + "@")
+	time.Sleep(2 * sourceDebounce)
+	waitFor(t, "the registry digest", func() bool {
+		got := pinSuggestion(name + "@")
+		if len(got) != 0 && strings.Contains(got[0].Text, "sha256:0000") {
+			t.Fatalf("the stale digest was suggested: %+v", got)
+		}
+		return len(got) == 1
+	})
+	if got := pinSuggestion(name + "@"); !strings.HasSuffix(got[0].Text, "@sha256:1111111111111111111111111111111111111111111111111111111111111111") || !strings.HasSuffix(got[0].Description, " ago") {
+		t.Errorf("the checked digest is suggested as %+v", got[0])
+	}
+	if registry.count("GET manifest") != 0 {
+		t.Errorf("pinning downloaded %d manifests", registry.count("GET manifest"))
+	}
+}
+
+func TestPinKeyBindRewritesTheImage(t *testing.T) {
+	defer useFakeDaemon(t, fakeDaemonSize{Images: 1})()
+	pinned := "nginx:1.0@sha256:" + strings.Repeat("0", 64)
+
+	for _, test := range []struct {
+		line   string
+		cursor int
+		want   string
+		after  string
+	}{
+		{"run nginx:1.0 sh", 16, "run " + pinned + " sh", ""},
+		{"run --rm -e A=1 nginx:1.0", 25, "run --rm -e A=1 " + pinned, ""},
+		{"@default run -it nginx:1.0 sh", 21, "@default run -it " + pinned + " sh", " sh"},
+		{"run nginx:1.0 sh", 2, "run " + pinned + " sh", " sh"},
+		{"run --name web", 14, "run --name web", ""},
+		{"ps -a", 5, "ps -a", ""},
+	} {
+		buffer := prompt.NewBuffer()
+		buffer.InsertText(test.line, false, true)
+		buffer.CursorLeft(len(test.line) - test.cursor)
+		pinKeyBind(buffer)
+
+		if got := buffer.Text(); got != test.want {
+			t.Errorf("%q: got %q, want %q", test.line, got, test.want)
+		}
+		if after := buffer.Document().TextAfterCursor(); test.want != test.line && after != test.after {
+			t.Errorf("%q: the cursor is followed by %q, want %q", test.line, after, test.after)
+		}
+	}
+}
+
+// slowRegistry answers after a delay, longer than F2 waits
+type slowRegistry struct {
+	*fakeRegistry
+	delay time.Duration
+}
+
+func (s slowRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	time.Sleep(s.delay)
+	s.fakeRegistry.ServeHTTP(w, r)
+}
+
+// the registry is asked in the background, F2 pins the image once the digest is known
+func TestPinKeyBindLooksUpTheRegistryInTheBackground(t *testing.T) {
+	defer useFakeDaemon(t, fakeDaemonSize{})()
+	digest := "sha256:" + strings.Repeat("2", 64)
+	registry := newFakeRegistry(map[string]string{"team/api:v1": digest})
+	host, restore := useFakeRegistry(t, slowRegistry{registry, 4 * pinKeyBindWait})
+	defer restore()
+
+	line := "run " + host + "/team/api:v1"
+	buffer := prompt.NewBuffer()
+	buffer.InsertText(line, false, true)
+
+	started := time.Now()
+	pinKeyBind(buffer)
+	if waited := time.Since(started); waited > 2*pinKeyBindWait {
+		t.Errorf("F2 waited %s for the registry", waited)
+	}
+	if buffer.Text() != line {
+		t.Fatalf("the line changed to %q before the digest was known", buffer.Text())
+	}
+
+	waitFor(t, "the pin", func() bool {
+		pinKeyBind(buffer)
+		return buffer.Text() != line
+	})
+	if want := line + "@" + digest; buffer.Text() != want {
+		t.Errorf("got %q, want %q", buffer.Text(), want)
+	}
+	if registry.count("GET manifest") != 0 {
+		t.Errorf("pinning downloaded %d manifests", registry.count("GET manifest"))
+	}
+}
+
+func TestPinnedReferenceHonoursTheHubBackoff(t *testing.T) {
+	defer useFakeDaemon(t, fakeDaemonSize{})()
+	previous := hubRateLimit
+	hubRateLimit = &hubQuota{blockedUntil: time.Now().Add(time.Minute)}
+	defer func() { hubRateLimit = previous }()
+
+	if _, _, err := pinnedReference("alpine:3"); err != errHubBackoff {
+		t.Errorf("got %v while backing off from Docker Hub", err)
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// hubQuotaLow is the share of the pull quota below which the prompt shows the remaining pulls
+	hubQuotaLow = 0.25
+	// hubQuotaReserve is the share of the pull quota left to explicit commands, completion stops every Hub request below it
+	hubQuotaReserve = 0.1
+	// hubDefaultBackoff is how long Hub queries are suspended after a 429 without Retry-After
+	hubDefaultBackoff = time.Minute
+)
+
+var errHubBackoff = errors.New("docker hub: rate limit nearly exhausted, backing off")
+
+// hubQuota is the Docker Hub pull quota as last reported by the `ratelimit-*` headers of the registry
+type hubQuota struct {
+	sync.Mutex
+	known        bool
+	limit        int
+	remaining    int
+	window       time.Duration
+	source       string
+	updated      time.Time
+	blockedUntil time.Time
+}
+
+var hubRateLimit = &hubQuota{}
+
+// parseRateLimitHeader parses a `100;w=21600` quota header into the count and its window
+func parseRateLimitHeader(value string) (int, time.Duration, bool) {
+	parts := strings.Split(value, ";")
+	count, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return 0, 0, false
+	}
+
+	window := time.Duration(0)
+	for _, part := range parts[1:] {
+		part = strings.TrimSpace(part)
+		if strings.HasPrefix(part, "w=") {
+			if seconds, err := strconv.Atoi(part[2:]); err == nil {
+				window = time.Duration(seconds) * time.Second
+			}
+		}
+	}
+
+	return count, window, true
+}
+
+// record updates the quota from the headers of a Hub response, a 429 suspends Hub queries until Retry-After
+func (q *hubQuota) record(response *http.Response) {
+	q.Lock()
+	defer q.Unlock()
+
+	limit, window, okLimit := parseRateLimitHeader(response.Header.Get("ratelimit-limit"))
+	remaining, _, okRemaining := parseRateLimitHeader(response.Header.Get("ratelimit-remaining"))
+	if okLimit && okRemaining {
+		q.known, q.limit, q.remaining, q.window, q.updated = true, limit, remaining, window, time.Now()
+		q.source = response.Header.Get("docker-ratelimit-source")
+	}
+
+	if response.StatusCode == http.StatusTooManyRequests {
+		backoff := hubDefaultBackoff
+		if seconds, err := strconv.Atoi(response.Header.Get("Retry-After")); err == nil {
+			backoff = time.Duration(seconds) * time.Second
+		} else if reset, err := strconv.ParseInt(response.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			backoff = time.Until(time.Unix(reset, 0))
+		}
+		q.blockedUntil = time.Now().Add(backoff)
+		if q.known {
+			q.remaining = 0
+		}
+	}
+}
+
+// backoff tells whether completion should leave Docker Hub alone: after a 429 or when the quota is nearly used up
+func (q *hubQuota) backoff() bool {
+	q.Lock()
+	defer q.Unlock()
+
+	if time.Now().Before(q.blockedUntil) {
+		return true
+	}
+	if !q.known || (q.window > 0 && time.Since(q.updated) > q.window) {
+		return false
+	}
+
+	return float64(q.remaining) <= float64(q.limit)*hubQuotaReserve
+}
+
+// completionPulls tells whether completion may download manifests from Docker Hub, which counts as a pull.
+// Once Docker Hub reported a quota the account is limited and completion leaves every pull to explicit commands,
+// previews fall back to digests, which are looked up with HEAD requests.
+func (q *hubQuota) completionPulls() bool {
+	q.Lock()
+	defer q.Unlock()
+
+	return !q.known && !time.Now().Before(q.blockedUntil)
+}
+
+// indicator is shown in the prompt while the quota is low
+func (q *hubQuota) indicator() string {
+	q.Lock()
+	defer q.Unlock()
+
+	if time.Now().Before(q.blockedUntil) {
+		return "[hub rate limited] "
+	}
+	if !q.known || (q.window > 0 && time.Since(q.updated) > q.window) {
+		return ""
+	}
+	if float64(q.remaining) > float64(q.limit)*hubQuotaLow {
+		return ""
+	}
+
+	return fmt.Sprintf("[hub %d/%d] ", q.remaining, q.limit)
+}
+
+// Status describes the last known quota
+func (q *hubQuota) Status() string {
+	q.Lock()
+	defer q.Unlock()
+
+	if !q.known {
+		return "Docker Hub didn't report a pull quota (unlimited or not queried yet)"
+	}
+
+	lines := []string{
+		fmt.Sprintf("Remaining:   %d of %d pulls", q.remaining, q.limit),
+		fmt.Sprintf("Window:      %s", q.window),
+		fmt.Sprintf("Updated:     %s", q.updated.Format(time.RFC3339)),
+	}
+	if q.source != "" {
+		lines = append(lines, fmt.Sprintf("Counted for: %s", q.source))
+	}
+	lines = append(lines, "Previews:    completion doesn't download manifests while a quota applies")
+	if time.Now().Before(q.blockedUntil) {
+		lines = append(lines, fmt.Sprintf("Backing off: until %s", q.blockedUntil.Format(time.RFC3339)))
+	} else if float64(q.remaining) <= float64(q.limit)*hubQuotaReserve {
+		lines = append(lines, "Backing off: completion stopped querying Docker Hub")
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// livePrefix shows the active context, a lost daemon and, when it gets low, the Hub quota in the prompt
+func livePrefix() (string, bool) {
+	indicator := contextIndicator() + health.indicator() + hubRateLimit.indicator()
+	if indicator == "" {
+		return "", false
+	}
+
+	return indicator + promptPrefix(), true
+}
+
+// refreshHubQuota asks the registry for the current quota. HEAD requests of manifests don't count as pulls.
+func refreshHubQuota() error {
+	repository := "ratelimitpreview/test"
+	header := http.Header{"Accept": {mediaTypeManifestList, mediaTypeManifest}}
+	response, err := getRegistryClient(dockerHubRegistryHost).do(http.MethodHead, "/v2/"+repository+"/manifests/latest", header, "repository:"+repository+":pull")
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK && response.StatusCode != http.StatusTooManyRequests {
+		return fmt.Errorf("%s: %s", response.Request.URL, response.Status)
+	}
+
+	return nil
+}
+
+func hubStatusBuiltin(args []string) {
+	if err := refreshHubQuota(); err != nil {
+		fmt.Fprintln(os.Stderr, "hub-status:", err)
+	}
+
+	fmt.Println(hubRateLimit.Status())
+}
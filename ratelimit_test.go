@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestHubQuotaCompletion(t *testing.T) {
+	response := func(status int, remaining string) *http.Response {
+		header := http.Header{}
+		if remaining != "" {
+			header.Set("ratelimit-limit", "100;w=21600")
+			header.Set("ratelimit-remaining", remaining+";w=21600")
+		}
+		return &http.Response{StatusCode: status, Header: header}
+	}
+
+	for _, test := range []struct {
+		name      string
+		status    int
+		remaining string
+		pulls     bool
+		backoff   bool
+	}{
+		{"unlimited", http.StatusOK, "", true, false},
+		{"limited", http.StatusOK, "90", false, false},
+		{"reserve", http.StatusOK, "10", false, true},
+		{"rate limited", http.StatusTooManyRequests, "", false, true},
+	} {
+		quota := &hubQuota{}
+		quota.record(response(test.status, test.remaining))
+		if got := quota.completionPulls(); got != test.pulls {
+			t.Errorf("%s: completion may pull is %v, want %v", test.name, got, test.pulls)
+		}
+		if got := quota.backoff(); got != test.backoff {
+			t.Errorf("%s: backoff is %v, want %v", test.name, got, test.backoff)
+		}
+	}
+}
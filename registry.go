@@ -0,0 +1,432 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/c-bata/go-prompt"
+)
+
+// dockerHubRegistries are the names Docker Hub credentials are stored under, they are served by hubClient
+var dockerHubRegistries = map[string]bool{
+	"https://index.docker.io/v1/": true,
+	"index.docker.io":             true,
+	"docker.io":                   true,
+	"registry-1.docker.io":        true,
+	"registry.hub.docker.com":     true,
+}
+
+// dockerConfigFile is the part of ~/.docker/config.json the shell cares about
+type dockerConfigFile struct {
+	Auths       map[string]dockerAuthConfig `json:"auths"`
+	CredsStore  string                      `json:"credsStore,omitempty"`
+	CredHelpers map[string]string           `json:"credHelpers,omitempty"`
+	// CurrentContext is the context `docker context use` selected
+	CurrentContext string `json:"currentContext,omitempty"`
+}
+
+type dockerAuthConfig struct {
+	Auth          string `json:"auth,omitempty"`
+	Username      string `json:"username,omitempty"`
+	Password      string `json:"password,omitempty"`
+	IdentityToken string `json:"identitytoken,omitempty"`
+}
+
+var authChallengeExpression = regexp.MustCompile(`(\w+)="([^"]*)"`)
+var linkNextExpression = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// dockerConfigDir returns the docker CLI configuration directory, honouring DOCKER_CONFIG
+func dockerConfigDir() string {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return dir
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(home, ".docker")
+}
+
+func loadDockerConfig() dockerConfigFile {
+	config := dockerConfigFile{}
+	content, err := ioutil.ReadFile(filepath.Join(dockerConfigDir(), "config.json"))
+	if err != nil {
+		return config
+	}
+	json.Unmarshal(content, &config)
+
+	return config
+}
+
+// registryHost strips the scheme and path docker login may have stored the registry with
+func registryHost(name string) string {
+	name = strings.TrimPrefix(strings.TrimPrefix(name, "https://"), "http://")
+	return strings.SplitN(name, "/", 2)[0]
+}
+
+// configuredRegistries lists the private registries logged in to or with a credential helper in config.json
+func configuredRegistries(config dockerConfigFile) []string {
+	seen := map[string]bool{}
+	hosts := []string{}
+	names := []string{}
+	for name := range config.Auths {
+		names = append(names, name)
+	}
+	for name := range config.CredHelpers {
+		names = append(names, name)
+	}
+
+	for _, name := range names {
+		host := registryHost(name)
+		if dockerHubRegistries[name] || dockerHubRegistries[host] || seen[host] {
+			continue
+		}
+		seen[host] = true
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	return hosts
+}
+
+// registryClient talks to a registry v2 API with basic or bearer token auth
+type registryClient struct {
+	host     string
+	baseURL  string
+	username string
+	password string
+	client   *http.Client
+
+	lock   sync.Mutex
+	tokens map[string]string
+}
+
+var registryClients = struct {
+	sync.Mutex
+	clients map[string]*registryClient
+}{clients: map[string]*registryClient{}}
+
+func newRegistryClient(host string, username string, password string) *registryClient {
+	baseURL := "https://" + host
+	if isInsecureRegistry(host) {
+		baseURL = "http://" + host
+	}
+	if host == dockerHubRegistryHost {
+		baseURL = settings.RegistryURL
+	}
+
+	return &registryClient{
+		host:     host,
+		baseURL:  baseURL,
+		username: username,
+		password: password,
+		client:   &http.Client{Timeout: settings.RegistryTimeout, Transport: settingsTransport},
+		tokens:   map[string]string{},
+	}
+}
+
+func getRegistryClient(host string) *registryClient {
+	registryClients.Lock()
+	defer registryClients.Unlock()
+
+	if client, ok := registryClients.clients[host]; ok {
+		return client
+	}
+
+	username, password := registryCredentials(loadDockerConfig(), host)
+	client := newRegistryClient(host, username, password)
+	registryClients.clients[host] = client
+
+	return client
+}
+
+// registryEndpoints returns the clients an image of host is fetched with: the anonymous mirror clients
+// first for Docker Hub images, then the client of the registry itself
+func registryEndpoints(host string) []*registryClient {
+	endpoints := []*registryClient{}
+	if host == dockerHubRegistryHost {
+		registryClients.Lock()
+		for _, mirror := range registryMirrors() {
+			mirror = strings.TrimSuffix(mirror, "/")
+			client, ok := registryClients.clients["mirror:"+mirror]
+			if !ok {
+				client = newRegistryClient(registryHost(mirror), "", "")
+				client.baseURL = mirror
+				registryClients.clients["mirror:"+mirror] = client
+			}
+			endpoints = append(endpoints, client)
+		}
+		registryClients.Unlock()
+	}
+
+	return append(endpoints, getRegistryClient(host))
+}
+
+// resolve returns the URL of path, or of the URL a Link header pointed at. The credentials of the registry are
+// sent along, URLs of another host or scheme are refused.
+func (r *registryClient) resolve(path string) (string, error) {
+	if strings.HasPrefix(path, "/") && !strings.HasPrefix(path, "//") {
+		return r.baseURL + path, nil
+	}
+
+	base, err := url.Parse(r.baseURL)
+	if err != nil {
+		return "", err
+	}
+	reference, err := url.Parse(path)
+	if err != nil {
+		return "", err
+	}
+	target := base.ResolveReference(reference)
+	if target.Scheme != base.Scheme || target.Host != base.Host {
+		return "", fmt.Errorf("%s: refusing to follow %s to another registry", r.host, path)
+	}
+
+	return target.String(), nil
+}
+
+// do sends a request, answering a 401 challenge with basic auth or a bearer token for scope
+func (r *registryClient) do(method string, path string, header http.Header, scope string) (*http.Response, error) {
+	target, err := r.resolve(path)
+	if err != nil {
+		return nil, err
+	}
+	request := func(authorization string) (*http.Response, error) {
+		req, err := http.NewRequest(method, target, nil)
+		if err != nil {
+			return nil, err
+		}
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		response, err := r.client.Do(req)
+		if err == nil && r.host == dockerHubRegistryHost {
+			hubRateLimit.record(response)
+		}
+		return response, err
+	}
+
+	r.lock.Lock()
+	token := r.tokens[scope]
+	r.lock.Unlock()
+	authorization := ""
+	if token != "" {
+		authorization = "Bearer " + token
+	}
+
+	response, err := request(authorization)
+	if err != nil || response.StatusCode != http.StatusUnauthorized {
+		return response, err
+	}
+	response.Body.Close()
+
+	challenge := response.Header.Get("WWW-Authenticate")
+	switch {
+	case strings.HasPrefix(strings.ToLower(challenge), "basic"):
+		if r.username == "" {
+			return nil, fmt.Errorf("%s: authentication required", r.host)
+		}
+		authorization = "Basic " + base64.StdEncoding.EncodeToString([]byte(r.username+":"+r.password))
+	case strings.HasPrefix(strings.ToLower(challenge), "bearer"):
+		token, err := r.fetchToken(challenge, scope)
+		if err != nil {
+			return nil, err
+		}
+		r.lock.Lock()
+		r.tokens[scope] = token
+		r.lock.Unlock()
+		authorization = "Bearer " + token
+	default:
+		return nil, fmt.Errorf("%s: unsupported authentication challenge %q", r.host, challenge)
+	}
+
+	return request(authorization)
+}
+
+func (r *registryClient) fetchToken(challenge string, scope string) (string, error) {
+	params := map[string]string{}
+	for _, match := range authChallengeExpression.FindAllStringSubmatch(challenge, -1) {
+		params[match[1]] = match[2]
+	}
+	if params["realm"] == "" {
+		return "", fmt.Errorf("%s: bearer challenge without realm", r.host)
+	}
+
+	values := url.Values{}
+	if params["service"] != "" {
+		values.Set("service", params["service"])
+	}
+	if scope == "" {
+		scope = params["scope"]
+	}
+	if scope != "" {
+		values.Set("scope", scope)
+	}
+
+	var req *http.Request
+	var err error
+	if r.username == identityTokenUsername {
+		// identity tokens are exchanged through the OAuth2 refresh token grant
+		values.Set("grant_type", "refresh_token")
+		values.Set("refresh_token", r.password)
+		values.Set("client_id", "docker-shell")
+		req, err = http.NewRequest(http.MethodPost, params["realm"], strings.NewReader(values.Encode()))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+	} else {
+		req, err = http.NewRequest(http.MethodGet, params["realm"]+"?"+values.Encode(), nil)
+		if err == nil && r.username != "" {
+			req.SetBasicAuth(r.username, r.password)
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+
+	response, err := r.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s: token request failed: %s", r.host, response.Status)
+	}
+
+	body := struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}{}
+	if err := json.NewDecoder(response.Body).Decode(&body); err != nil {
+		return "", err
+	}
+	if body.Token == "" {
+		body.Token = body.AccessToken
+	}
+
+	return body.Token, nil
+}
+
+// Catalog lists every repository of the registry, following pagination links
+func (r *registryClient) Catalog() ([]string, error) {
+	repositories := []string{}
+	next := "/v2/_catalog?n=100"
+	for next != "" {
+		response, err := r.do(http.MethodGet, next, nil, "registry:catalog:*")
+		if err != nil {
+			return nil, err
+		}
+
+		page := struct {
+			Repositories []string `json:"repositories"`
+		}{}
+		err = decodeRegistryResponse(response, &page)
+		if err != nil {
+			return nil, err
+		}
+		repositories = append(repositories, page.Repositories...)
+
+		next = ""
+		if match := linkNextExpression.FindStringSubmatch(response.Header.Get("Link")); match != nil {
+			next = match[1]
+		}
+	}
+
+	return repositories, nil
+}
+
+// Tags lists the tags of a repository
+func (r *registryClient) Tags(repository string) ([]string, error) {
+	response, err := r.do(http.MethodGet, "/v2/"+repository+"/tags/list", nil, "repository:"+repository+":pull")
+	if err != nil {
+		return nil, err
+	}
+
+	page := struct {
+		Tags []string `json:"tags"`
+	}{}
+	if err := decodeRegistryResponse(response, &page); err != nil {
+		return nil, err
+	}
+	sort.Strings(page.Tags)
+
+	return page.Tags, nil
+}
+
+func decodeRegistryResponse(response *http.Response, v interface{}) error {
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", response.Request.URL, response.Status)
+	}
+
+	return json.NewDecoder(response.Body).Decode(v)
+}
+
+func registryRepositories(host string) []string {
+	repositories := []string{}
+	completionCache.FetchAsync("registry:"+host+":catalog", 5*time.Minute, &repositories, func() (interface{}, error) {
+		return getRegistryClient(host).Catalog()
+	})
+
+	return repositories
+}
+
+func registryTags(host string, repository string) []string {
+	tags := []string{}
+	completionCache.FetchAsync("registry:"+host+":tags:"+repository, 5*time.Minute, &tags, func() (interface{}, error) {
+		return getRegistryClient(host).Tags(repository)
+	})
+
+	return tags
+}
+
+// registrySuggestion completes `registry.host/repository[:tag]` for the registries of config.json
+func registrySuggestion(word string) []prompt.Suggest {
+	suggestions := []prompt.Suggest{}
+	for _, host := range configuredRegistries(loadDockerConfig()) {
+		if !strings.HasPrefix(word, host+"/") {
+			if strings.HasPrefix(host, word) {
+				suggestions = append(suggestions, prompt.Suggest{Text: host + "/", Description: "Private registry"})
+			}
+			continue
+		}
+
+		reference := strings.TrimPrefix(word, host+"/")
+		if strings.Contains(reference, ":") {
+			suggestions = append(suggestions, tagSuggestion(word)...)
+			continue
+		}
+
+		for _, repository := range registryRepositories(host) {
+			suggestions = append(suggestions, prompt.Suggest{Text: host + "/" + repository, Description: host})
+		}
+	}
+
+	return prompt.FilterHasPrefix(suggestions, word, true)
+}
+
+// isRegistryReference tells whether an image reference starts with a registry host rather than a Hub namespace
+func isRegistryReference(reference string) bool {
+	parts := strings.SplitN(reference, "/", 2)
+	if len(parts) < 2 {
+		return false
+	}
+
+	return strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost"
+}
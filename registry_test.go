@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/c-bata/go-prompt"
+)
+
+// fakeRegistry serves the registry v2 API for tagged single platform images and counts the requests it answers.
+// Repositories listed in private ask for basic auth.
+type fakeRegistry struct {
+	sync.Mutex
+	// digests maps "repository:tag" to the digest of its manifest
+	digests  map[string]string
+	private  map[string]bool
+	requests map[string]int
+}
+
+func newFakeRegistry(digests map[string]string) *fakeRegistry {
+	return &fakeRegistry{digests: digests, private: map[string]bool{}, requests: map[string]int{}}
+}
+
+func (f *fakeRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/v2/")
+	f.Lock()
+	defer f.Unlock()
+
+	repository := strings.TrimSuffix(path, "/tags/list")
+	if index := strings.Index(path, "/manifests/"); index != -1 {
+		repository = path[:index]
+	}
+	if f.private[repository] && r.Header.Get("Authorization") == "" {
+		w.Header().Set("WWW-Authenticate", `Basic realm="fake registry"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	case strings.HasSuffix(path, "/tags/list"):
+		f.requests["tags"]++
+		tags := []string{}
+		for name := range f.digests {
+			if strings.HasPrefix(name, repository+":") {
+				tags = append(tags, strings.TrimPrefix(name, repository+":"))
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"name": repository, "tags": tags})
+	case strings.Contains(path, "/manifests/"):
+		f.requests[r.Method+" manifest"]++
+		reference := path[strings.LastIndex(path, "/")+1:]
+		digest, ok := f.digests[repository+":"+reference]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", mediaTypeManifest)
+		w.Header().Set("Docker-Content-Digest", digest)
+		if r.Method == http.MethodGet {
+			json.NewEncoder(w).Encode(registryManifest{
+				SchemaVersion: 2,
+				MediaType:     mediaTypeManifest,
+				Config:        registryDescriptor{Digest: "sha256:config", Size: 1000},
+				Layers:        []registryDescriptor{{Size: 2000000}, {Size: 3000000}},
+			})
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeRegistry) count(request string) int {
+	f.Lock()
+	defer f.Unlock()
+
+	return f.requests[request]
+}
+
+// useFakeRegistry serves registry on a local host, spoken to over plain HTTP, with a memory only cache and
+// without credentials. It returns the host and a function restoring the previous state.
+func useFakeRegistry(t *testing.T, registry http.Handler) (string, func()) {
+	server := httptest.NewServer(registry)
+	host := server.Listener.Addr().String()
+	configDir, err := ioutil.TempDir("", "docker-shell-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previousConfig, configSet := os.LookupEnv("DOCKER_CONFIG")
+	previousCache := completionCache
+	os.Setenv("DOCKER_CONFIG", configDir)
+	completionCache = newSuggestionCache("")
+
+	return host, func() {
+		if configSet {
+			os.Setenv("DOCKER_CONFIG", previousConfig)
+		} else {
+			os.Unsetenv("DOCKER_CONFIG")
+		}
+		completionCache = previousCache
+		registryClients.Lock()
+		delete(registryClients.clients, host)
+		registryClients.Unlock()
+		server.Close()
+		os.RemoveAll(configDir)
+	}
+}
+
+func descriptions(suggestions []prompt.Suggest) map[string]string {
+	result := map[string]string{}
+	for _, s := range suggestions {
+		result[s.Text] = s.Description
+	}
+
+	return result
+}
+
+// listing tags costs no pull, only the tag the user settled on has its manifest downloaded
+func TestTagSuggestionPreviews(t *testing.T) {
+	registry := newFakeRegistry(map[string]string{
+		"team/api:v1": "sha256:1111111111111111111111111111111111111111111111111111111111111111",
+		"team/api:v2": "sha256:2222222222222222222222222222222222222222222222222222222222222222",
+		"team/api:v3": "sha256:3333333333333333333333333333333333333333333333333333333333333333",
+	})
+	host, restore := useFakeRegistry(t, registry)
+	defer restore()
+
+	word := host + "/team/api:v"
+	waitFor(t, "the tags and their digests", func() bool {
+		got := descriptions(tagSuggestion(word))
+		return len(got) == 3 && got[host+"/team/api:v3"] == "sha256:333333333333"
+	})
+	if registry.count("GET manifest") != 0 {
+		t.Errorf("listing tags downloaded %d manifests", registry.count("GET manifest"))
+	}
+
+	waitFor(t, "the manifest preview", func() bool {
+		return strings.Contains(tagSuggestion(word + "2")[0].Description, "2 layers")
+	})
+	if registry.count("GET manifest") != 1 {
+		t.Errorf("previewing one tag downloaded %d manifests", registry.count("GET manifest"))
+	}
+}
+
+// the registry credentials stay with the registry when a catalog page links to another host
+func TestCatalogFollowsLinksOnlyOnTheRegistry(t *testing.T) {
+	elsewhere := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("the catalog was followed to another host with %q", r.Header.Get("Authorization"))
+	}))
+	defer elsewhere.Close()
+
+	var registry *httptest.Server
+	registry = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="fake registry"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Query().Get("last") {
+		case "":
+			w.Header().Set("Link", `</v2/_catalog?last=a&n=100>; rel="next"`)
+			json.NewEncoder(w).Encode(map[string][]string{"repositories": {"a"}})
+		case "a":
+			w.Header().Set("Link", "<"+registry.URL+`/v2/_catalog?last=b&n=100>; rel="next"`)
+			json.NewEncoder(w).Encode(map[string][]string{"repositories": {"b"}})
+		case "b":
+			w.Header().Set("Link", "<"+elsewhere.URL+`/v2/_catalog?last=c&n=100>; rel="next"`)
+			json.NewEncoder(w).Encode(map[string][]string{"repositories": {"c"}})
+		}
+	}))
+	defer registry.Close()
+
+	client := newRegistryClient(registry.Listener.Addr().String(), "alice", "s3cret")
+	if _, err := client.Catalog(); err == nil || !strings.Contains(err.Error(), "refusing to follow") {
+		t.Errorf("the link to another host isn't refused: %v", err)
+	}
+}
+
+func TestRegistryClientResolve(t *testing.T) {
+	client := newRegistryClient("registry.example.com", "", "")
+	for _, test := range []struct {
+		path string
+		want string
+	}{
+		{"/v2/_catalog?n=100", "https://registry.example.com/v2/_catalog?n=100"},
+		{"https://registry.example.com/v2/_catalog?last=a", "https://registry.example.com/v2/_catalog?last=a"},
+		{"v2/_catalog?last=a", "https://registry.example.com/v2/_catalog?last=a"},
+		{"https://evil.example.com/v2/_catalog", ""},
+		{"//evil.example.com/v2/_catalog", ""},
+		{"http://registry.example.com/v2/_catalog", ""},
+	} {
+		got, err := client.resolve(test.path)
+		if got != test.want || (err == nil) != (test.want != "") {
+			t.Errorf("%q: got %q, %v, want %q", test.path, got, err, test.want)
+		}
+	}
+}
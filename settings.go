@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	docker "docker.io/go-docker"
+	commands "github.com/mstrYoda/docker-shell/lib"
+	"gopkg.in/yaml.v2"
+)
+
+// shellSettings configures how the shell reaches Docker Hub and registries.
+// It is read from config.yaml in the configuration directory and overridden by DOCKER_SHELL_* variables.
+type shellSettings struct {
+	// HubURL is the Docker Hub web API used for search and tag listings
+	HubURL string `yaml:"hub_url"`
+	// RegistryURL is the registry API serving Docker Hub images
+	RegistryURL string `yaml:"registry_url"`
+	// RegistryMirrors are tried before RegistryURL for Docker Hub images, followed by the daemon mirrors
+	RegistryMirrors    []string `yaml:"registry_mirrors"`
+	InsecureRegistries []string `yaml:"insecure_registries"`
+
+	HTTPProxy  string `yaml:"http_proxy"`
+	HTTPSProxy string `yaml:"https_proxy"`
+	NoProxy    string `yaml:"no_proxy"`
+	// CACert is a PEM bundle trusted in addition to the system roots
+	CACert string `yaml:"ca_cert"`
+
+	HubTimeout      time.Duration `yaml:"hub_timeout"`
+	HubRetries      int           `yaml:"hub_retries"`
+	RegistryTimeout time.Duration `yaml:"registry_timeout"`
+
+	// SSHCommand opens the connection to ssh:// daemons, `docker system dial-stdio` is run on the remote host
+	SSHCommand string `yaml:"ssh_command"`
+	// Engine is docker, podman or auto to detect Podman from the daemon version
+	Engine string `yaml:"engine"`
+}
+
+// settingsFile returns the path of the shell configuration file
+func settingsFile() string {
+	dir := commands.UserConfigDir()
+	if dir == "" {
+		return ""
+	}
+
+	return filepath.Join(dir, "config.yaml")
+}
+
+func defaultSettings() shellSettings {
+	return shellSettings{
+		HubURL:          "https://hub.docker.com",
+		RegistryURL:     "https://" + dockerHubRegistryHost,
+		HubTimeout:      1 * time.Second,
+		HubRetries:      3,
+		RegistryTimeout: 2 * time.Second,
+		SSHCommand:      "ssh",
+		Engine:          "auto",
+	}
+}
+
+// loadSettings reads the configuration file and the environment. Defaults are kept for anything
+// which is not set or fails to parse, the error is reported once the shell starts.
+func loadSettings() (shellSettings, error) {
+	settings := defaultSettings()
+	var loadErr error
+
+	if path := settingsFile(); path != "" {
+		content, err := ioutil.ReadFile(path)
+		if err == nil {
+			if err := yaml.UnmarshalStrict(content, &settings); err != nil {
+				settings, loadErr = defaultSettings(), fmt.Errorf("%s: %v", path, err)
+			}
+		} else if !os.IsNotExist(err) {
+			loadErr = err
+		}
+	}
+
+	setString := func(name string, target *string) {
+		if value := os.Getenv(name); value != "" {
+			*target = value
+		}
+	}
+	setString("DOCKER_SHELL_HUB_URL", &settings.HubURL)
+	setString("DOCKER_SHELL_REGISTRY_URL", &settings.RegistryURL)
+	setString("DOCKER_SHELL_HTTP_PROXY", &settings.HTTPProxy)
+	setString("DOCKER_SHELL_HTTPS_PROXY", &settings.HTTPSProxy)
+	setString("DOCKER_SHELL_NO_PROXY", &settings.NoProxy)
+	setString("DOCKER_SHELL_CA_CERT", &settings.CACert)
+	setString("DOCKER_SHELL_SSH_COMMAND", &settings.SSHCommand)
+	setString("DOCKER_SHELL_ENGINE", &settings.Engine)
+	if mirrors := os.Getenv("DOCKER_SHELL_REGISTRY_MIRRORS"); mirrors != "" {
+		settings.RegistryMirrors = strings.Split(mirrors, ",")
+	}
+
+	setDuration := func(name string, target *time.Duration) {
+		if value := os.Getenv(name); value != "" {
+			duration, err := time.ParseDuration(value)
+			if err != nil {
+				loadErr = fmt.Errorf("%s: %v", name, err)
+				return
+			}
+			*target = duration
+		}
+	}
+	setDuration("DOCKER_SHELL_HUB_TIMEOUT", &settings.HubTimeout)
+	setDuration("DOCKER_SHELL_REGISTRY_TIMEOUT", &settings.RegistryTimeout)
+	if value := os.Getenv("DOCKER_SHELL_HUB_RETRIES"); value != "" {
+		retries, err := strconv.Atoi(value)
+		if err != nil {
+			loadErr = fmt.Errorf("DOCKER_SHELL_HUB_RETRIES: %v", err)
+		} else {
+			settings.HubRetries = retries
+		}
+	}
+
+	settings.HubURL = strings.TrimSuffix(settings.HubURL, "/")
+	settings.RegistryURL = strings.TrimSuffix(settings.RegistryURL, "/")
+
+	return settings, loadErr
+}
+
+var settings, settingsError = loadSettings()
+
+// settingsTransport is the HTTP transport of the Hub and registry clients, with the configured proxies and CA bundle.
+// A CA bundle which can't be read is reported and the system roots are used alone.
+var settingsTransport, transportError = newSettingsTransport(settings)
+
+func newSettingsTransport(settings shellSettings) (*http.Transport, error) {
+	transport := &http.Transport{
+		Proxy: settings.proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+	if settings.CACert == "" {
+		return transport, nil
+	}
+
+	pem, err := ioutil.ReadFile(settings.CACert)
+	if err != nil {
+		return transport, err
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return transport, fmt.Errorf("%s: no certificates found", settings.CACert)
+	}
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+
+	return transport, nil
+}
+
+// proxy picks the configured proxy of a request, falling back to HTTP_PROXY, HTTPS_PROXY and NO_PROXY
+func (s shellSettings) proxy(request *http.Request) (*url.URL, error) {
+	if s.HTTPProxy == "" && s.HTTPSProxy == "" {
+		return http.ProxyFromEnvironment(request)
+	}
+
+	host := request.URL.Hostname()
+	for _, pattern := range strings.Split(s.NoProxy, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "*" || (pattern != "" && (host == strings.TrimPrefix(pattern, ".") || strings.HasSuffix(host, "."+strings.TrimPrefix(pattern, ".")))) {
+			return nil, nil
+		}
+	}
+
+	proxy := s.HTTPProxy
+	if request.URL.Scheme == "https" && s.HTTPSProxy != "" {
+		proxy = s.HTTPSProxy
+	}
+	if proxy == "" {
+		return nil, nil
+	}
+
+	return url.Parse(proxy)
+}
+
+// isInsecureRegistry tells whether a registry is spoken to over plain HTTP
+func (s shellSettings) isInsecureRegistry(host string) bool {
+	if isLoopbackRegistry(host) {
+		return true
+	}
+	for _, insecure := range s.InsecureRegistries {
+		if registryHost(insecure) == host {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isLoopbackRegistry tells whether a registry host[:port] runs on this machine, the daemon talks plain HTTP to
+// those by default
+func isLoopbackRegistry(host string) bool {
+	hostname := host
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		hostname = name
+	}
+	hostname = strings.TrimSuffix(strings.TrimPrefix(hostname, "["), "]")
+	if hostname == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(hostname)
+
+	return ip != nil && ip.IsLoopback()
+}
+
+// daemonRegistries are the registry mirrors and insecure registries of the daemon the shell is connected to.
+// They are replaced on every connection and kept apart from the user's settings, so switching contexts
+// doesn't carry the previous daemon's registries over.
+var daemonRegistries = struct {
+	sync.RWMutex
+	mirrors  []string
+	insecure []string
+}{}
+
+// loadDaemonRegistries replaces the registry mirrors and insecure registries with the ones of the daemon
+func loadDaemonRegistries(ctx context.Context, client *docker.Client) {
+	mirrors, insecure := []string{}, []string{}
+	if info, err := client.Info(ctx); err == nil && info.RegistryConfig != nil {
+		mirrors = append(mirrors, info.RegistryConfig.Mirrors...)
+		for _, index := range info.RegistryConfig.IndexConfigs {
+			if !index.Secure {
+				insecure = append(insecure, index.Name)
+			}
+		}
+	}
+
+	daemonRegistries.Lock()
+	daemonRegistries.mirrors, daemonRegistries.insecure = mirrors, insecure
+	daemonRegistries.Unlock()
+
+	// registry clients chose between HTTP and HTTPS with the previous daemon's insecure registries
+	registryClients.Lock()
+	registryClients.clients = map[string]*registryClient{}
+	registryClients.Unlock()
+}
+
+// registryMirrors returns the configured mirrors followed by the ones of the daemon
+func registryMirrors() []string {
+	daemonRegistries.RLock()
+	defer daemonRegistries.RUnlock()
+
+	mirrors := append([]string{}, settings.RegistryMirrors...)
+	for _, mirror := range daemonRegistries.mirrors {
+		if !containsEntry(mirrors, mirror) {
+			mirrors = append(mirrors, mirror)
+		}
+	}
+
+	return mirrors
+}
+
+// isInsecureRegistry tells whether the settings or the daemon declare a registry insecure
+func isInsecureRegistry(host string) bool {
+	if settings.isInsecureRegistry(host) {
+		return true
+	}
+
+	daemonRegistries.RLock()
+	defer daemonRegistries.RUnlock()
+	for _, insecure := range daemonRegistries.insecure {
+		if registryHost(insecure) == host {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsEntry(values []string, value string) bool {
+	for _, v := range values {
+		if strings.TrimSuffix(v, "/") == strings.TrimSuffix(value, "/") {
+			return true
+		}
+	}
+
+	return false
+}
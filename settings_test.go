@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	docker "docker.io/go-docker"
+	"docker.io/go-docker/api/types"
+	"docker.io/go-docker/api/types/registry"
+)
+
+// registryDaemon answers /info with the registry configuration of a daemon
+func registryDaemon(t *testing.T, mirrors []string, insecure string) (*docker.Client, func()) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/info") {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(types.Info{RegistryConfig: &registry.ServiceConfig{
+			Mirrors:      mirrors,
+			IndexConfigs: map[string]*registry.IndexInfo{insecure: {Name: insecure, Secure: false}, "docker.io": {Name: "docker.io", Secure: true}},
+		}})
+	}))
+	client, err := docker.NewClient("tcp://"+server.Listener.Addr().String(), "1.35", server.Client(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return client, server.Close
+}
+
+func TestDaemonRegistriesFollowTheConnection(t *testing.T) {
+	previousMirrors := settings.RegistryMirrors
+	settings.RegistryMirrors = []string{"https://mirror.example.com"}
+	defer func() {
+		settings.RegistryMirrors = previousMirrors
+		daemonRegistries.Lock()
+		daemonRegistries.mirrors, daemonRegistries.insecure = nil, nil
+		daemonRegistries.Unlock()
+	}()
+
+	staging, closeStaging := registryDaemon(t, []string{"https://staging-mirror.example.com/"}, "staging.internal:5000")
+	defer closeStaging()
+	production, closeProduction := registryDaemon(t, []string{"https://production-mirror.example.com"}, "production.internal:5000")
+	defer closeProduction()
+
+	loadDaemonRegistries(context.Background(), staging)
+	if got := strings.Join(registryMirrors(), " "); got != "https://mirror.example.com https://staging-mirror.example.com/" {
+		t.Errorf("mirrors with the staging daemon: %s", got)
+	}
+	if !isInsecureRegistry("staging.internal:5000") || isInsecureRegistry("docker.io") {
+		t.Error("insecure registries of the staging daemon aren't used")
+	}
+
+	loadDaemonRegistries(context.Background(), production)
+	if got := strings.Join(registryMirrors(), " "); got != "https://mirror.example.com https://production-mirror.example.com" {
+		t.Errorf("mirrors after switching daemons: %s", got)
+	}
+	if isInsecureRegistry("staging.internal:5000") || !isInsecureRegistry("production.internal:5000") {
+		t.Error("insecure registries of the previous daemon are still used")
+	}
+	if len(settings.RegistryMirrors) != 1 || len(settings.InsecureRegistries) != 0 {
+		t.Errorf("the user settings changed: %v %v", settings.RegistryMirrors, settings.InsecureRegistries)
+	}
+}
+
+func TestRegistryMirrorsAreTriedFirst(t *testing.T) {
+	digest := "sha256:4444444444444444444444444444444444444444444444444444444444444444"
+	hub := newFakeRegistry(map[string]string{"library/nginx:latest": digest, "library/redis:latest": digest})
+	hubHost, restore := useFakeRegistry(t, hub)
+	defer restore()
+	mirror := httptest.NewServer(newFakeRegistry(map[string]string{"library/nginx:latest": digest}))
+	defer mirror.Close()
+
+	previousMirrors, previousRegistry := settings.RegistryMirrors, settings.RegistryURL
+	settings.RegistryMirrors, settings.RegistryURL = []string{mirror.URL}, "http://"+hubHost
+	registryClients.Lock()
+	registryClients.clients = map[string]*registryClient{}
+	registryClients.Unlock()
+	defer func() {
+		settings.RegistryMirrors, settings.RegistryURL = previousMirrors, previousRegistry
+		registryClients.Lock()
+		registryClients.clients = map[string]*registryClient{}
+		registryClients.Unlock()
+	}()
+
+	if got, err := fetchDigest(parseImageReference("nginx")); got != digest || err != nil {
+		t.Fatalf("nginx: %s %v", got, err)
+	}
+	if hub.count("HEAD manifest") != 0 {
+		t.Error("the registry was asked although the mirror has the image")
+	}
+	if got, err := fetchDigest(parseImageReference("redis")); got != digest || err != nil {
+		t.Fatalf("redis: %s %v", got, err)
+	}
+	if hub.count("HEAD manifest") != 1 {
+		t.Error("the registry wasn't asked for an image the mirror doesn't have")
+	}
+}
+
+func TestInsecureRegistriesUsePlainHTTP(t *testing.T) {
+	previous := settings.InsecureRegistries
+	settings.InsecureRegistries = []string{"http://registry.internal:5000/"}
+	defer func() { settings.InsecureRegistries = previous }()
+
+	for host, want := range map[string]string{
+		"registry.internal:5000":      "http://registry.internal:5000",
+		"localhost:5000":              "http://localhost:5000",
+		"localhost":                   "http://localhost",
+		"127.0.0.2:5000":              "http://127.0.0.2:5000",
+		"[::1]:5000":                  "http://[::1]:5000",
+		"registry.example.com":        "https://registry.example.com",
+		"localhost-registry.corp.com": "https://localhost-registry.corp.com",
+		"localhost.corp.com:5000":     "https://localhost.corp.com:5000",
+		"127.0.0.1.evil.io":           "https://127.0.0.1.evil.io",
+	} {
+		if got := newRegistryClient(host, "", "").baseURL; got != want {
+			t.Errorf("%s: got %s, want %s", host, got, want)
+		}
+	}
+}
+
+func TestCABundle(t *testing.T) {
+	digest := "sha256:5555555555555555555555555555555555555555555555555555555555555555"
+	server := httptest.NewUnstartedServer(newFakeRegistry(map[string]string{"team/api:v1": digest}))
+	server.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+
+	bundle, err := ioutil.TempFile("", "docker-shell-ca*.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(bundle.Name())
+	pem.Encode(bundle, &pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	bundle.Close()
+
+	digestWith := func(s shellSettings) (string, error) {
+		transport, err := newSettingsTransport(s)
+		if err != nil {
+			return "", err
+		}
+		client := &registryClient{baseURL: server.URL, client: &http.Client{Transport: transport}, tokens: map[string]string{}}
+		return client.Digest("team/api", "v1")
+	}
+
+	if _, err := digestWith(shellSettings{}); err == nil {
+		t.Error("the registry certificate is trusted without the CA bundle")
+	}
+	if got, err := digestWith(shellSettings{CACert: bundle.Name()}); got != digest || err != nil {
+		t.Errorf("with the CA bundle: %s %v", got, err)
+	}
+	if _, err := newSettingsTransport(shellSettings{CACert: os.Args[0]}); err == nil || !strings.Contains(err.Error(), "no certificates found") {
+		t.Errorf("a file without certificates is reported as %v", err)
+	}
+}
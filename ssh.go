@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	docker "docker.io/go-docker"
+	"docker.io/go-docker/api"
+)
+
+// sshStderrLimit bounds the ssh output kept to explain a failed connection
+const sshStderrLimit = 4096
+
+// sshDialArgs returns the arguments of the ssh command which connect to the daemon of an ssh://[user@]host[:port] URL
+func sshDialArgs(host string) ([]string, error) {
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "ssh" || u.Hostname() == "" {
+		return nil, fmt.Errorf("%s: expected ssh://[user@]host[:port]", host)
+	}
+	if u.Path != "" && u.Path != "/" {
+		return nil, fmt.Errorf("%s: ssh hosts can't have a path", host)
+	}
+
+	args := []string{}
+	if u.User != nil {
+		args = append(args, "-l", u.User.Username())
+	}
+	if u.Port() != "" {
+		args = append(args, "-p", u.Port())
+	}
+
+	return append(args, "--", u.Hostname(), "docker", "system", "dial-stdio"), nil
+}
+
+// newSSHClient creates a client which talks to a remote daemon through `ssh host docker system dial-stdio`,
+// like the docker CLI. Every connection of the client is a new ssh process.
+func newSSHClient(host string) (*docker.Client, error) {
+	args, err := sshDialArgs(host)
+	if err != nil {
+		return nil, err
+	}
+	command := strings.Fields(settings.SSHCommand)
+	if len(command) == 0 {
+		return nil, fmt.Errorf("%s: no ssh command configured", host)
+	}
+
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dialCommand(host, command[0], append(command[1:], args...)...)
+		},
+		IdleConnTimeout: 30 * time.Second,
+	}
+	version := pinnedAPIVersion()
+	if version == "" {
+		version = api.DefaultVersion
+	}
+
+	// the address only names the daemon in requests, connections are made by DialContext
+	return docker.NewClient("tcp://docker", version, &http.Client{Transport: transport}, nil)
+}
+
+// commandConn is a connection to the stdin and stdout of a process
+type commandConn struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.ReadCloser
+	stderr *limitedBuffer
+	addr   commandAddr
+
+	closeOnce sync.Once
+	waitOnce  sync.Once
+}
+
+func dialCommand(host string, name string, args ...string) (net.Conn, error) {
+	cmd := exec.Command(name, args...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr := &limitedBuffer{limit: sshStderrLimit}
+	cmd.Stderr = stderr
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("%s: %v", host, err)
+	}
+
+	return &commandConn{cmd: cmd, stdin: stdin, stdout: stdout, stderr: stderr, addr: commandAddr(host)}, nil
+}
+
+// Read reports what the command wrote to stderr when its output ends, e.g. why ssh couldn't connect
+func (c *commandConn) Read(p []byte) (int, error) {
+	n, err := c.stdout.Read(p)
+	if err == io.EOF {
+		// stderr is complete once the process has been waited for
+		c.wait()
+		if message := c.stderr.String(); message != "" {
+			return n, fmt.Errorf("%s: %s", c.addr, strings.TrimSpace(message))
+		}
+	}
+
+	return n, err
+}
+
+func (c *commandConn) Write(p []byte) (int, error) {
+	return c.stdin.Write(p)
+}
+
+// CloseWrite closes stdin, the remote side sees the end of the request stream
+func (c *commandConn) CloseWrite() error {
+	return c.stdin.Close()
+}
+
+func (c *commandConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.stdin.Close()
+		c.stdout.Close()
+		if c.cmd.Process != nil {
+			c.cmd.Process.Kill()
+		}
+		c.wait()
+	})
+
+	return nil
+}
+
+func (c *commandConn) wait() {
+	c.waitOnce.Do(func() { c.cmd.Wait() })
+}
+
+func (c *commandConn) LocalAddr() net.Addr  { return c.addr }
+func (c *commandConn) RemoteAddr() net.Addr { return c.addr }
+
+// deadlines aren't supported by pipes, requests are bounded by their context instead
+func (c *commandConn) SetDeadline(t time.Time) error      { return nil }
+func (c *commandConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *commandConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// commandAddr is the host a command connects to
+type commandAddr string
+
+func (a commandAddr) Network() string { return "ssh" }
+func (a commandAddr) String() string  { return string(a) }
+
+// limitedBuffer keeps the first bytes written to it
+type limitedBuffer struct {
+	lock   sync.Mutex
+	buffer bytes.Buffer
+	limit  int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if room := b.limit - b.buffer.Len(); room > 0 {
+		if len(p) > room {
+			b.buffer.Write(p[:room])
+		} else {
+			b.buffer.Write(p)
+		}
+	}
+
+	return len(p), nil
+}
+
+func (b *limitedBuffer) String() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.buffer.String()
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"docker.io/go-docker/api/types"
+)
+
+// sshStandInAddr makes the test binary act as ssh: stdin and stdout are connected to the fake daemon listening there
+const sshStandInAddr = "DOCKER_SHELL_TEST_SSH_STAND_IN"
+
+// TestSSHStandIn isn't a test, it is the ssh command the SSH transport runs in the tests below
+func TestSSHStandIn(t *testing.T) {
+	addr := os.Getenv(sshStandInAddr)
+	if addr == "" {
+		return
+	}
+	args := os.Args[len(os.Args)-3:]
+	if strings.Join(args, " ") != "docker system dial-stdio" {
+		os.Stderr.WriteString("unexpected remote command " + strings.Join(args, " "))
+		os.Exit(255)
+	}
+	if addr == "refuse" {
+		os.Stderr.WriteString("ssh: connect to host example.com port 22: Connection refused")
+		os.Exit(255)
+	}
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		os.Stderr.WriteString(err.Error())
+		os.Exit(255)
+	}
+	go func() {
+		io.Copy(conn, os.Stdin)
+		conn.(*net.TCPConn).CloseWrite()
+	}()
+	io.Copy(os.Stdout, conn)
+	os.Exit(0)
+}
+
+// useSSHStandIn points the ssh command at the test binary, relaying to addr
+func useSSHStandIn(addr string) func() {
+	previous := settings.SSHCommand
+	settings.SSHCommand = os.Args[0] + " -test.run=^TestSSHStandIn$ --"
+	os.Setenv(sshStandInAddr, addr)
+
+	return func() {
+		settings.SSHCommand = previous
+		os.Unsetenv(sshStandInAddr)
+	}
+}
+
+func TestSSHTransport(t *testing.T) {
+	server := httptest.NewServer(newFakeDaemon(fakeDaemonSize{Containers: 30, Images: 5}))
+	defer server.Close()
+	defer useSSHStandIn(server.Listener.Addr().String())()
+
+	client, err := newSSHClient("ssh://deploy@example.com:2222")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	containers, err := client.ContainerList(ctx, types.ContainerListOptions{All: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(containers) != 30 {
+		t.Errorf("listed %d containers through ssh, want 30", len(containers))
+	}
+}
+
+func TestSSHTransportReportsSSHErrors(t *testing.T) {
+	defer useSSHStandIn("refuse")()
+
+	client, err := newSSHClient("ssh://example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := client.ContainerList(ctx, types.ContainerListOptions{}); err == nil || !strings.Contains(err.Error(), "Connection refused") {
+		t.Errorf("got %v, want the ssh error", err)
+	}
+}
+
+func TestSSHDialArgs(t *testing.T) {
+	for host, want := range map[string]string{
+		"ssh://example.com":                "-- example.com docker system dial-stdio",
+		"ssh://deploy@example.com:2222":    "-l deploy -p 2222 -- example.com docker system dial-stdio",
+		"ssh://deploy@example.com/var/run": "",
+		"tcp://example.com:2376":           "",
+	} {
+		args, err := sshDialArgs(host)
+		if got := strings.Join(args, " "); got != want || (err == nil) != (want != "") {
+			t.Errorf("%s: got %q (%v), want %q", host, got, err, want)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	docker "docker.io/go-docker"
+	"docker.io/go-docker/api/types"
+	"docker.io/go-docker/api/types/filters"
+	"docker.io/go-docker/api/types/swarm"
+
+	"github.com/c-bata/go-prompt"
+)
+
+const stackNamespaceLabel = "com.docker.stack.namespace"
+
+// swarmState is the services of the swarm with their running task count
+type swarmState struct {
+	Services []swarm.Service
+	Running  map[string]int
+}
+
+func swarmServices() ([]swarm.Service, map[string]int, error) {
+	state := swarmState{}
+	fetchAsync("swarm-services", 5*time.Second, sourceDeadline, &state, func(ctx context.Context, client *docker.Client) (interface{}, error) {
+		return loadSwarmServices(ctx, client)
+	})
+
+	return state.Services, state.Running, sourceError("swarm-services")
+}
+
+func loadSwarmServices(ctx context.Context, client *docker.Client) (interface{}, error) {
+	services, err := client.ServiceList(ctx, types.ServiceListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	args := filters.NewArgs()
+	args.Add("desired-state", "running")
+	tasks, err := client.TaskList(ctx, types.TaskListOptions{Filters: args})
+	running := map[string]int{}
+	if err == nil {
+		for _, task := range tasks {
+			if task.Status.State == swarm.TaskStateRunning {
+				running[task.ServiceID]++
+			}
+		}
+	}
+
+	sort.Slice(services, func(i, j int) bool { return services[i].Spec.Name < services[j].Spec.Name })
+	return swarmState{Services: services, Running: running}, nil
+}
+
+func serviceImage(service swarm.Service) string {
+	if service.Spec.TaskTemplate.ContainerSpec == nil {
+		return ""
+	}
+
+	// images are pinned by digest when deployed, the tag is what the user recognizes
+	return strings.SplitN(service.Spec.TaskTemplate.ContainerSpec.Image, "@", 2)[0]
+}
+
+func serviceReplicas(service swarm.Service, running int) string {
+	if service.Spec.Mode.Replicated != nil && service.Spec.Mode.Replicated.Replicas != nil {
+		return fmt.Sprintf("%d/%d", running, *service.Spec.Mode.Replicated.Replicas)
+	}
+
+	return fmt.Sprintf("%d global", running)
+}
+
+func serviceSuggestion() ([]prompt.Suggest, error) {
+	services, running, err := swarmServices()
+	suggestions := []prompt.Suggest{}
+	for _, service := range services {
+		suggestions = append(suggestions, prompt.Suggest{
+			Text:        service.Spec.Name,
+			Description: fmt.Sprintf("(%s) %s", serviceReplicas(service, running[service.ID]), serviceImage(service)),
+		})
+	}
+
+	return suggestions, err
+}
+
+// serviceScaleSuggestion suggests `service=N` pre-filled with the current replica count of replicated services
+func serviceScaleSuggestion() ([]prompt.Suggest, error) {
+	services, running, err := swarmServices()
+	suggestions := []prompt.Suggest{}
+	for _, service := range services {
+		if service.Spec.Mode.Replicated == nil || service.Spec.Mode.Replicated.Replicas == nil {
+			continue
+		}
+		suggestions = append(suggestions, prompt.Suggest{
+			Text:        fmt.Sprintf("%s=%d", service.Spec.Name, *service.Spec.Mode.Replicated.Replicas),
+			Description: fmt.Sprintf("(%d running) %s", running[service.ID], serviceImage(service)),
+		})
+	}
+
+	return suggestions, err
+}
+
+// serviceTaskSuggestion suggests services followed by their tasks, as `service logs` accepts both
+func serviceTaskSuggestion() ([]prompt.Suggest, error) {
+	suggestions, err := serviceSuggestion()
+
+	services, _, _ := swarmServices()
+	names := map[string]string{}
+	for _, service := range services {
+		names[service.ID] = service.Spec.Name
+	}
+
+	tasks := []swarm.Task{}
+	fetchAsync("swarm-tasks", 5*time.Second, sourceDeadline, &tasks, func(ctx context.Context, client *docker.Client) (interface{}, error) {
+		args := filters.NewArgs()
+		args.Add("desired-state", "running")
+		return client.TaskList(ctx, types.TaskListOptions{Filters: args})
+	})
+	sort.Slice(tasks, func(i, j int) bool {
+		if tasks[i].ServiceID != tasks[j].ServiceID {
+			return names[tasks[i].ServiceID] < names[tasks[j].ServiceID]
+		}
+		return tasks[i].Slot < tasks[j].Slot
+	})
+
+	for _, task := range tasks {
+		name := names[task.ServiceID]
+		if task.Slot != 0 {
+			name = fmt.Sprintf("%s.%d", name, task.Slot)
+		}
+		suggestions = append(suggestions, prompt.Suggest{Text: task.ID, Description: fmt.Sprintf("task %s (%s)", name, task.Status.State)})
+	}
+	if err == nil {
+		err = sourceError("swarm-tasks")
+	}
+
+	return suggestions, err
+}
+
+func nodeSuggestion() ([]prompt.Suggest, error) {
+	nodes := []swarm.Node{}
+	fetchAsync("swarm-nodes", 10*time.Second, sourceDeadline, &nodes, func(ctx context.Context, client *docker.Client) (interface{}, error) {
+		return client.NodeList(ctx, types.NodeListOptions{})
+	})
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Description.Hostname < nodes[j].Description.Hostname })
+
+	suggestions := []prompt.Suggest{}
+	for _, node := range nodes {
+		description := fmt.Sprintf("%s, %s, %s", node.Spec.Role, node.Spec.Availability, node.Status.State)
+		if node.ManagerStatus != nil && node.ManagerStatus.Leader {
+			description += ", leader"
+		}
+		suggestions = append(suggestions, prompt.Suggest{Text: node.Description.Hostname, Description: description})
+	}
+
+	return suggestions, sourceError("swarm-nodes")
+}
+
+func stackSuggestion() ([]prompt.Suggest, error) {
+	services, _, err := swarmServices()
+	counts := map[string]int{}
+	for _, service := range services {
+		if stack, ok := service.Spec.Labels[stackNamespaceLabel]; ok {
+			counts[stack]++
+		}
+	}
+
+	stacks := make([]string, 0, len(counts))
+	for stack := range counts {
+		stacks = append(stacks, stack)
+	}
+	sort.Strings(stacks)
+
+	suggestions := []prompt.Suggest{}
+	for _, stack := range stacks {
+		suggestions = append(suggestions, prompt.Suggest{Text: stack, Description: fmt.Sprintf("%d service(s)", counts[stack])})
+	}
+
+	return suggestions, err
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/c-bata/go-prompt"
+)
+
+// completeLoaded completes text once the completion sources it reads have loaded
+func completeLoaded(t *testing.T, text string) []prompt.Suggest {
+	d := documentOf(text, len(text))
+	deadline := time.Now().Add(5 * time.Second)
+	for completer(d); completionLoading(); completer(d) {
+		if time.Now().After(deadline) {
+			t.Fatalf("%q: completion sources still loading after 5s", text)
+		}
+		time.Sleep(sourceDebounce + 50*time.Millisecond)
+	}
+
+	return completer(d)
+}
+
+func TestSwarmCompleters(t *testing.T) {
+	defer useFakeDaemon(t, fakeDaemonSize{Services: 4, Nodes: 2})()
+
+	for _, test := range []struct {
+		text string
+		want []prompt.Suggest
+	}{
+		{"service inspect ", []prompt.Suggest{
+			{Text: "app_0", Description: "(2/2) nginx"},
+			{Text: "app_1", Description: "(2/3) redis"},
+			{Text: "app_2", Description: "(2 global) postgres"},
+			{Text: "app_3", Description: "(1/2) node"},
+		}},
+		{"service scale ", []prompt.Suggest{
+			{Text: "app_0=2", Description: "(2 running) nginx"},
+			{Text: "app_1=3", Description: "(2 running) redis"},
+			{Text: "app_3=2", Description: "(1 running) node"},
+		}},
+		{"service scale app_0=5 app_1", []prompt.Suggest{
+			{Text: "app_1=3", Description: "(2 running) redis"},
+		}},
+		{"service scale app_3=", []prompt.Suggest{
+			{Text: "app_3=2", Description: "(1 running) node"},
+		}},
+		{"service logs app_1", []prompt.Suggest{
+			{Text: "app_1", Description: "(2/3) redis"},
+		}},
+		{"service logs " + fakeID('t', 4), []prompt.Suggest{
+			{Text: fakeID('t', 4), Description: "task app_1.3 (starting)"},
+		}},
+		{"service logs " + fakeID('t', 5), []prompt.Suggest{
+			{Text: fakeID('t', 5), Description: "task app_2 (running)"},
+		}},
+		{"node inspect ", []prompt.Suggest{
+			{Text: "node_0", Description: "manager, active, ready, leader"},
+			{Text: "node_1", Description: "worker, active, ready"},
+		}},
+		{"stack rm ", []prompt.Suggest{
+			{Text: "stack_0", Description: "2 service(s)"},
+			{Text: "stack_1", Description: "1 service(s)"},
+		}},
+	} {
+		got := completeLoaded(t, test.text)
+		if len(got) != len(test.want) {
+			t.Errorf("%q: got %v, want %v", test.text, got, test.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("%q: got %v, want %v", test.text, got, test.want)
+				break
+			}
+		}
+	}
+}
+
+// `service logs` suggests the tasks of every service after the services
+func TestServiceTaskSuggestionOrdersTasksBySlot(t *testing.T) {
+	defer useFakeDaemon(t, fakeDaemonSize{Services: 2, Nodes: 1})()
+
+	got := completeLoaded(t, "service logs ")
+	want := []string{"app_0", "app_1", "task app_0.1 (running)", "task app_0.2 (running)", "task app_1.1 (running)", "task app_1.2 (running)", "task app_1.3 (starting)"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i, s := range got {
+		// services are named by their text, tasks by their description
+		name := s.Text
+		if i >= 2 {
+			name = s.Description
+		}
+		if name != want[i] {
+			t.Errorf("suggestion %d is %v, want %s", i, s, want[i])
+		}
+	}
+}